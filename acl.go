@@ -0,0 +1,376 @@
+package telegrambot
+
+// Role-based access control with cached chat administrators
+//
+// https://core.telegram.org/bots/api#getchatadministrators
+
+import (
+	"fmt"
+	"sync"
+	"time"
+)
+
+const (
+	defaultACLCacheTTLSeconds = 300
+)
+
+// Role is a role of a user in a chat (ordered by privileges)
+type Role int
+
+// Roles
+const (
+	RoleNone          Role = iota // left or kicked
+	RoleRestricted                // restricted member
+	RoleMember                    // member (or user in a private chat)
+	RoleAdministrator             // chat administrator
+	RoleCreator                   // chat creator
+	RoleOwner                     // owner of this bot (from ACLConfig.Owners)
+)
+
+// String function for Role
+func (r Role) String() string {
+	switch r {
+	case RoleNone:
+		return "none"
+	case RoleRestricted:
+		return "restricted"
+	case RoleMember:
+		return "member"
+	case RoleAdministrator:
+		return "administrator"
+	case RoleCreator:
+		return "creator"
+	case RoleOwner:
+		return "owner"
+	}
+	return fmt.Sprintf("role(%d)", int(r))
+}
+
+// ChatMemberPermission is a permission of a chat member
+type ChatMemberPermission string
+
+// ChatMemberPermission strings
+const (
+	PermissionCanBeEdited        ChatMemberPermission = "can_be_edited"
+	PermissionCanPostMessages    ChatMemberPermission = "can_post_messages"
+	PermissionCanEditMessages    ChatMemberPermission = "can_edit_messages"
+	PermissionCanDeleteMessages  ChatMemberPermission = "can_delete_messages"
+	PermissionCanRestrictMembers ChatMemberPermission = "can_restrict_members"
+	PermissionCanPromoteMembers  ChatMemberPermission = "can_promote_members"
+	PermissionCanChangeInfo      ChatMemberPermission = "can_change_info"
+	PermissionCanInviteUsers     ChatMemberPermission = "can_invite_users"
+	PermissionCanPinMessages     ChatMemberPermission = "can_pin_messages"
+	PermissionCanSendMessages    ChatMemberPermission = "can_send_messages"
+)
+
+// ACLConfig is a struct of configurations for ACL
+type ACLConfig struct {
+	Owners []int `json:"owners"` // user ids of bot owners (allowed everything in every chat)
+
+	CacheTTLSeconds int `json:"cache_ttl_seconds"` // default: 300
+
+	// called when an update is denied by guards (if nil, it will be logged when Bot.Verbose == true)
+	OnDenied func(b *Bot, update Update, reason string) `json:"-"`
+}
+
+// cached members of a chat
+type aclChatCache struct {
+	administrators map[int]ChatMember // nil if not fetched yet
+	adminsExpireAt time.Time
+
+	members map[int]aclMemberCache
+}
+
+// cached member
+type aclMemberCache struct {
+	member    ChatMember
+	expiresAt time.Time
+}
+
+// ACL checks roles and permissions of users in chats
+type ACL struct {
+	owners   map[int]bool
+	ttl      time.Duration
+	onDenied func(b *Bot, update Update, reason string)
+
+	sync.Mutex
+	chats map[int64]*aclChatCache
+}
+
+// NewACL generates a new ACL with given config.
+func NewACL(config ACLConfig) *ACL {
+	if config.CacheTTLSeconds <= 0 {
+		config.CacheTTLSeconds = defaultACLCacheTTLSeconds
+	}
+
+	owners := map[int]bool{}
+	for _, owner := range config.Owners {
+		owners[owner] = true
+	}
+
+	return &ACL{
+		owners:   owners,
+		ttl:      time.Duration(config.CacheTTLSeconds) * time.Second,
+		onDenied: config.OnDenied,
+		chats:    map[int64]*aclChatCache{},
+	}
+}
+
+// IsOwner checks if given user is an owner of this bot.
+func (a *ACL) IsOwner(userID int) bool {
+	return a.owners[userID]
+}
+
+// Member returns the chat member of given user. (from cache if possible)
+func (a *ACL) Member(b *Bot, chatID int64, userID int) (ChatMember, error) {
+	// administrators are fetched all together
+	if admins, err := a.administrators(b, chatID); err == nil {
+		if admin, exists := admins[userID]; exists {
+			return admin, nil
+		}
+	} else {
+		b.verbose("falling back to chat member: %s", err)
+	}
+
+	now := time.Now()
+
+	a.Lock()
+	cache := a.chatCache(chatID)
+	if cached, exists := cache.members[userID]; exists && now.Before(cached.expiresAt) {
+		a.Unlock()
+		return cached.member, nil
+	}
+	a.Unlock()
+
+	res := b.GetChatMember(chatID, userID)
+	if !res.Ok || res.Result == nil {
+		return ChatMember{}, fmt.Errorf("failed to get chat member: %s", descriptionOf(res.APIResponseBase))
+	}
+
+	a.Lock()
+	a.chatCache(chatID).members[userID] = aclMemberCache{
+		member:    *res.Result,
+		expiresAt: now.Add(a.ttl),
+	}
+	a.Unlock()
+
+	return *res.Result, nil
+}
+
+// Role returns the role of given user in given chat.
+func (a *ACL) Role(b *Bot, chat Chat, userID int) (Role, error) {
+	if a.IsOwner(userID) {
+		return RoleOwner, nil
+	}
+	if chat.Type == ChatTypePrivate {
+		return RoleMember, nil
+	}
+
+	member, err := a.Member(b, chat.ID, userID)
+	if err != nil {
+		return RoleNone, err
+	}
+
+	return roleOf(member), nil
+}
+
+// HasPermissions checks if given user has all given permissions in given chat.
+//
+// Owners of this bot and chat creators have all permissions, and users in private chats have none.
+func (a *ACL) HasPermissions(b *Bot, chat Chat, userID int, permissions ...ChatMemberPermission) (bool, error) {
+	if a.IsOwner(userID) {
+		return true, nil
+	}
+	if chat.Type == ChatTypePrivate {
+		return len(permissions) == 0, nil
+	}
+
+	member, err := a.Member(b, chat.ID, userID)
+	if err != nil {
+		return false, err
+	}
+
+	for _, permission := range permissions {
+		if !memberHasPermission(member, permission) {
+			return false, nil
+		}
+	}
+
+	return true, nil
+}
+
+// Invalidate removes cached members of given chat.
+func (a *ACL) Invalidate(chatID int64) {
+	a.Lock()
+	defer a.Unlock()
+
+	delete(a.chats, chatID)
+}
+
+// Observe invalidates cached members when given update has member-change service messages.
+func (a *ACL) Observe(update Update) {
+	if message := update.GetMessage(); message != nil {
+		if len(message.NewChatMembers) > 0 || message.LeftChatMember != nil {
+			a.Invalidate(message.Chat.ID)
+		}
+	}
+}
+
+// Middleware returns a middleware which observes member-change service messages for refreshing caches.
+func (a *ACL) Middleware() Middleware {
+	return func(next Handler) Handler {
+		return HandlerFunc(func(ctx *UpdateContext) {
+			if ctx.Err == nil {
+				a.Observe(ctx.Update)
+			}
+
+			next.HandleUpdate(ctx)
+		})
+	}
+}
+
+// RequireRole returns a middleware which passes only the updates from users with given role or higher.
+func (a *ACL) RequireRole(role Role) Middleware {
+	return a.guard(func(b *Bot, chat Chat, userID int) (bool, string, error) {
+		actual, err := a.Role(b, chat, userID)
+		if err != nil {
+			return false, "", err
+		}
+		return actual >= role, fmt.Sprintf("role '%s' < required '%s'", actual, role), nil
+	})
+}
+
+// RequirePermissions returns a middleware which passes only the updates from users with all given permissions.
+func (a *ACL) RequirePermissions(permissions ...ChatMemberPermission) Middleware {
+	return a.guard(func(b *Bot, chat Chat, userID int) (bool, string, error) {
+		allowed, err := a.HasPermissions(b, chat, userID, permissions...)
+		return allowed, fmt.Sprintf("missing permissions: %v", permissions), err
+	})
+}
+
+// Generate a guard middleware with given check function.
+func (a *ACL) guard(check func(b *Bot, chat Chat, userID int) (allowed bool, reason string, err error)) Middleware {
+	return func(next Handler) Handler {
+		return HandlerFunc(func(ctx *UpdateContext) {
+			if ctx.Err != nil {
+				next.HandleUpdate(ctx)
+				return
+			}
+
+			var reason string
+			chat, from := ctx.Update.GetChat(), ctx.Update.GetFrom()
+			if chat == nil || from == nil {
+				reason = "no chat or user in update"
+			} else if allowed, why, err := check(ctx.Bot, *chat, from.ID); err != nil {
+				reason = fmt.Sprintf("failed to check access: %s", err)
+			} else if !allowed {
+				reason = why
+			} else {
+				next.HandleUpdate(ctx)
+				return
+			}
+
+			if a.onDenied != nil {
+				a.onDenied(ctx.Bot, ctx.Update, reason)
+			} else {
+				ctx.Bot.verbose("denied update #%d: %s", ctx.Update.UpdateID, reason)
+			}
+		})
+	}
+}
+
+// Get administrators of given chat. (from cache if possible)
+func (a *ACL) administrators(b *Bot, chatID int64) (map[int]ChatMember, error) {
+	now := time.Now()
+
+	a.Lock()
+	cache := a.chatCache(chatID)
+	if cache.administrators != nil && now.Before(cache.adminsExpireAt) {
+		admins := cache.administrators
+		a.Unlock()
+		return admins, nil
+	}
+	a.Unlock()
+
+	res := b.GetChatAdministrators(chatID)
+	if !res.Ok {
+		return nil, fmt.Errorf("failed to get chat administrators: %s", descriptionOf(res.APIResponseBase))
+	}
+
+	admins := map[int]ChatMember{}
+	for _, admin := range res.Result {
+		admins[admin.User.ID] = admin
+	}
+
+	a.Lock()
+	cache = a.chatCache(chatID)
+	cache.administrators, cache.adminsExpireAt = admins, now.Add(a.ttl)
+	a.Unlock()
+
+	return admins, nil
+}
+
+// Get (or create) the cache of given chat. (lock should be held)
+func (a *ACL) chatCache(chatID int64) *aclChatCache {
+	cache, exists := a.chats[chatID]
+	if !exists {
+		cache = &aclChatCache{
+			members: map[int]aclMemberCache{},
+		}
+		a.chats[chatID] = cache
+	}
+	return cache
+}
+
+// Get the role of given chat member.
+func roleOf(member ChatMember) Role {
+	switch member.Status {
+	case ChatMemberStatusCreator:
+		return RoleCreator
+	case ChatMemberStatusAdministrator:
+		return RoleAdministrator
+	case ChatMemberStatusMember:
+		return RoleMember
+	case ChatMemberStatusRestricted:
+		if member.IsMember {
+			return RoleRestricted
+		}
+	}
+	return RoleNone
+}
+
+// Check if given chat member has given permission.
+func memberHasPermission(member ChatMember, permission ChatMemberPermission) bool {
+	switch member.Status {
+	case ChatMemberStatusCreator:
+		return true
+	case ChatMemberStatusMember:
+		return permission == PermissionCanSendMessages
+	case ChatMemberStatusLeft, ChatMemberStatusKicked:
+		return false
+	}
+
+	switch permission {
+	case PermissionCanBeEdited:
+		return member.CanBeEdited
+	case PermissionCanPostMessages:
+		return member.CanPostMessages
+	case PermissionCanEditMessages:
+		return member.CanEditMessages
+	case PermissionCanDeleteMessages:
+		return member.CanDeleteMessages
+	case PermissionCanRestrictMembers:
+		return member.CanRestrictMembers
+	case PermissionCanPromoteMembers:
+		return member.CanPromoteMembers
+	case PermissionCanChangeInfo:
+		return member.CanChangeInfo
+	case PermissionCanInviteUsers:
+		return member.CanInviteUsers
+	case PermissionCanPinMessages:
+		return member.CanPinMessages
+	case PermissionCanSendMessages:
+		return member.Status == ChatMemberStatusAdministrator || member.CanSendMessages
+	}
+	return false
+}
@@ -0,0 +1,205 @@
+package telegrambot
+
+// Aggregating messages of media groups (albums)
+//
+// https://core.telegram.org/bots/api#sendmediagroup
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+)
+
+const (
+	defaultAlbumWindow = 1 * time.Second
+	maxAlbumMessages   = 10 // max number of media in a media group
+)
+
+// context keys for album
+const (
+	ContextKeyAlbum = "album" // *Album, set by AlbumMiddleware
+)
+
+// Album is a group of messages which were sent together as a media group
+type Album struct {
+	MediaGroupID string
+	Chat         Chat
+	Messages     []Message // sorted by message id
+}
+
+// Photos returns the largest photo sizes of photo messages in the album.
+func (a *Album) Photos() []PhotoSize {
+	photos := []PhotoSize{}
+	for _, message := range a.Messages {
+		if len(message.Photo) > 0 {
+			largest := message.Photo[0]
+			for _, photo := range message.Photo[1:] {
+				if photo.Width*photo.Height > largest.Width*largest.Height {
+					largest = photo
+				}
+			}
+			photos = append(photos, largest)
+		}
+	}
+	return photos
+}
+
+// Videos returns videos in the album.
+func (a *Album) Videos() []Video {
+	videos := []Video{}
+	for _, message := range a.Messages {
+		if message.Video != nil {
+			videos = append(videos, *message.Video)
+		}
+	}
+	return videos
+}
+
+// Documents returns documents in the album.
+func (a *Album) Documents() []Document {
+	documents := []Document{}
+	for _, message := range a.Messages {
+		if message.Document != nil {
+			documents = append(documents, *message.Document)
+		}
+	}
+	return documents
+}
+
+// Audios returns audios in the album.
+func (a *Album) Audios() []Audio {
+	audios := []Audio{}
+	for _, message := range a.Messages {
+		if message.Audio != nil {
+			audios = append(audios, *message.Audio)
+		}
+	}
+	return audios
+}
+
+// Captions returns non-empty captions of messages in the album.
+func (a *Album) Captions() []string {
+	captions := []string{}
+	for _, message := range a.Messages {
+		if message.Caption != nil && *message.Caption != "" {
+			captions = append(captions, *message.Caption)
+		}
+	}
+	return captions
+}
+
+// Caption returns the first non-empty caption of the album. (usually the album's caption)
+func (a *Album) Caption() string {
+	if captions := a.Captions(); len(captions) > 0 {
+		return captions[0]
+	}
+	return ""
+}
+
+// AlbumFrom returns the album of given context. (nil if the update is not from an album)
+func AlbumFrom(ctx *UpdateContext) *Album {
+	if value, exists := ctx.Get(ContextKeyAlbum); exists {
+		if album, ok := value.(*Album); ok {
+			return album
+		}
+	}
+	return nil
+}
+
+// buffered messages of a media group
+type albumBuffer struct {
+	contexts []*UpdateContext
+	timer    *time.Timer
+}
+
+// AlbumMiddleware buffers messages (and channel posts) with the same media group id,
+// and passes them to the next handlers as one update when no more message arrives for given window. (default: 1 second)
+//
+// The next handlers receive the context of the first message, with the album set with key: ContextKeyAlbum.
+// Other updates pass through immediately.
+//
+// Buffered albums are delivered from other goroutines, so middleware which do things
+// after the next handlers (eg. SessionMiddleware) should be placed after this one.
+func AlbumMiddleware(window time.Duration) Middleware {
+	if window <= 0 {
+		window = defaultAlbumWindow
+	}
+
+	var lock sync.Mutex
+	buffers := map[string]*albumBuffer{}
+
+	return func(next Handler) Handler {
+		// deliver buffered messages of given key
+		flush := func(key string) {
+			lock.Lock()
+			buffer, exists := buffers[key]
+			if exists {
+				buffer.timer.Stop()
+				delete(buffers, key)
+			}
+			lock.Unlock()
+
+			if !exists {
+				return
+			}
+
+			sort.SliceStable(buffer.contexts, func(i, j int) bool {
+				return albumMessageOf(buffer.contexts[i].Update).MessageID < albumMessageOf(buffer.contexts[j].Update).MessageID
+			})
+
+			first := buffer.contexts[0]
+			message := albumMessageOf(first.Update)
+			album := &Album{
+				MediaGroupID: *message.MediaGroupID,
+				Chat:         message.Chat,
+			}
+			for _, ctx := range buffer.contexts {
+				album.Messages = append(album.Messages, *albumMessageOf(ctx.Update))
+			}
+			first.Set(ContextKeyAlbum, album)
+
+			first.Bot.verbose("delivering album %s with %d message(s)", album.MediaGroupID, len(album.Messages))
+
+			next.HandleUpdate(first)
+		}
+
+		return HandlerFunc(func(ctx *UpdateContext) {
+			message := albumMessageOf(ctx.Update)
+			if ctx.Err != nil || message == nil || message.MediaGroupID == nil {
+				next.HandleUpdate(ctx)
+				return
+			}
+
+			key := fmt.Sprintf("%d:%s", message.Chat.ID, *message.MediaGroupID)
+
+			lock.Lock()
+			buffer, exists := buffers[key]
+			if !exists {
+				buffer = &albumBuffer{
+					timer: time.AfterFunc(window, func() {
+						flush(key)
+					}),
+				}
+				buffers[key] = buffer
+			} else {
+				buffer.timer.Reset(window)
+			}
+			buffer.contexts = append(buffer.contexts, ctx)
+			full := len(buffer.contexts) >= maxAlbumMessages
+			lock.Unlock()
+
+			if full {
+				flush(key)
+			}
+		})
+	}
+}
+
+// Return the (new) message or channel post of given update which can be a part of an album.
+func albumMessageOf(update Update) *Message {
+	if update.Message != nil {
+		return update.Message
+	}
+	return update.ChannelPost
+}
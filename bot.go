@@ -7,14 +7,14 @@ package telegrambot
 
 import (
 	"crypto/md5"
+	"errors"
 	"fmt"
 	"log"
 	"net"
 	"net/http"
 	"os"
-	"os/exec"
-	"strconv"
 	"strings"
+	"sync"
 	"time"
 )
 
@@ -23,12 +23,17 @@ const (
 	fileBaseURL = "https://api.telegram.org/file/bot"
 
 	webhookPath = "/telegram/bot/webhook"
+
+	maxWebhookBodyBytes = 1024 * 1024 // max size of a webhook request body (1MB)
 )
 
 const (
 	redactedString = "<REDACTED>" // confidential info will be displayed as this
 )
 
+// error for webhook request bodies larger than maxWebhookBodyBytes
+var errWebhookBodyTooLarge = errors.New("webhook request body too large")
+
 // loggers
 var _stdout = log.New(os.Stdout, "", log.LstdFlags)
 var _stderr = log.New(os.Stderr, "", log.LstdFlags)
@@ -38,15 +43,19 @@ type Bot struct {
 	token       string // Telegram bot API's token
 	tokenHashed string // hashed token
 
-	webhookHost string // webhook hostname
-	webhookPort int    // webhook port number
-	webhookURL  string // webhook url
+	webhookHost       string               // webhook hostname
+	webhookPort       int                  // webhook port number
+	webhookURL        string               // webhook url (guarded by webhookLock)
+	webhookCert       *InputFile           // certificate registered with webhook url (guarded by webhookLock)
+	webhookCustomPath string               // custom path of webhook url
+	webhookAuth       webhookAuthenticator // authenticator of webhook requests (guarded by webhookLock)
+	webhookLock       sync.RWMutex         // lock for webhook settings which are accessed while serving webhooks
 
 	httpClient *http.Client // http client
 
 	quitLoop chan struct{} // quit channel of monitoring loop
 
-	updateHandler func(b *Bot, update Update, err error) // update(webhook) handler function
+	chatMigrations chatMigrationTable // known chat migrations
 
 	Verbose bool // print verbose log messages or not
 }
@@ -74,20 +83,15 @@ func NewClient(token string) *Bot {
 	}
 }
 
-// GenCertAndKey generates a certificate and a private key file with given domain.
-// (`OpenSSL` is needed.)
+// GenCertAndKey generates a self-signed certificate and a private key file with given domain(or IP address).
+//
+// For more options (key type, subject, SANs, ...), use GenCertAndKeyWithOptions().
 func GenCertAndKey(domain string, outCertFilepath string, outKeyFilepath string, expiresInDays int) error {
-	numBits := 2048
-	country := "US"
-	state := "New York"
-	local := "Brooklyn"
-	org := "Example Company"
-
-	if _, err := exec.Command("openssl", "req", "-newkey", fmt.Sprintf("rsa:%d", numBits), "-sha256", "-nodes", "-keyout", outKeyFilepath, "-x509", "-days", strconv.Itoa(expiresInDays), "-out", outCertFilepath, "-subj", fmt.Sprintf("/C=%s/ST=%s/L=%s/O=%s/CN=%s", country, state, local, org, domain)).Output(); err != nil {
-		return err
-	}
-
-	return nil
+	return GenCertAndKeyWithOptions(
+		NewCertOptions(domain, time.Duration(expiresInDays)*24*time.Hour),
+		outCertFilepath,
+		outKeyFilepath,
+	)
 }
 
 // StartWebhookServerAndWait starts a webhook server(and waits forever).
@@ -104,14 +108,52 @@ func (b *Bot) StartWebhookServerAndWait(certFilepath string, keyFilepath string,
 		b.error("given webhook handler is nil")
 		return
 	}
-	b.updateHandler = webhookHandler
 
+	// start server
+	server := b.newWebhookServer(b.WebhookHandler(webhookHandler))
+	if err := server.ListenAndServeTLS(certFilepath, keyFilepath); err != nil {
+		panic(err.Error())
+	}
+}
+
+// WebhookHandler returns a http.Handler which receives webhooks and passes them to given webhookHandler function.
+//
+// It can be mounted on an existing router (on the path of webhook url),
+// or placed behind a TLS-terminating proxy.
+//
+// If webhookHandler is nil, the returned handler will respond to all requests with 500.
+func (b *Bot) WebhookHandler(webhookHandler func(b *Bot, webhook Update, err error)) http.Handler {
+	if webhookHandler == nil {
+		return b.missingWebhookHandler()
+	}
+
+	return http.HandlerFunc(func(writer http.ResponseWriter, req *http.Request) {
+		b.serveWebhook(writer, req, func(webhook Update, err error) *WebhookReply {
+			webhookHandler(b, webhook, err)
+
+			return nil
+		})
+	})
+}
+
+// Return a http.Handler which responds to all webhook requests with 500, for nil webhook handlers.
+func (b *Bot) missingWebhookHandler() http.Handler {
+	b.error("given webhook handler is nil")
+
+	return http.HandlerFunc(func(writer http.ResponseWriter, req *http.Request) {
+		b.error("webhook request is not handled: no webhook handler")
+
+		http.Error(writer, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+	})
+}
+
+// Build a http server for receiving webhooks with given handler.
+func (b *Bot) newWebhookServer(handler http.Handler) *http.Server {
 	// routing
 	mux := http.NewServeMux()
-	mux.HandleFunc(b.getWebhookPath(), b.handleWebhook)
+	mux.Handle(b.getWebhookPath(), handler)
 
-	// start server
-	server := &http.Server{
+	return &http.Server{
 		Addr:              fmt.Sprintf(":%d", b.webhookPort),
 		Handler:           mux,
 		ReadTimeout:       10 * time.Second,
@@ -119,9 +161,6 @@ func (b *Bot) StartWebhookServerAndWait(certFilepath string, keyFilepath string,
 		WriteTimeout:      10 * time.Second,
 		IdleTimeout:       60 * time.Second,
 	}
-	if err := server.ListenAndServeTLS(certFilepath, keyFilepath); err != nil {
-		panic(err.Error())
-	}
 }
 
 // StartMonitoringUpdates retrieves updates from API server constantly.
@@ -136,12 +175,11 @@ func (b *Bot) StartMonitoringUpdates(updateOffset int, interval int, updateHandl
 		SetLimit(100). // default: 100
 		SetTimeout(1)  // default: 0 for testing
 
-	// set update handler
+	// check update handler
 	if updateHandler == nil {
 		b.error("given update handler is nil")
 		return
 	}
-	b.updateHandler = updateHandler
 
 	var updates APIResponseUpdates
 loop:
@@ -157,10 +195,10 @@ loop:
 						options["offset"] = update.UpdateID + 1
 					}
 
-					go b.updateHandler(b, update, nil)
+					go updateHandler(b, update, nil)
 				}
 			} else {
-				go b.updateHandler(b, Update{}, fmt.Errorf("%s", *updates.Description))
+				go updateHandler(b, Update{}, fmt.Errorf("%s", *updates.Description))
 			}
 
 			time.Sleep(time.Duration(interval) * time.Second)
@@ -177,11 +215,39 @@ func (b *Bot) StopMonitoringUpdates() {
 	b.quitLoop <- struct{}{}
 }
 
-// Get webhook path generated with hash.
+// Get webhook path. (custom one, or generated with hash)
 func (b *Bot) getWebhookPath() string {
+	if b.webhookCustomPath != "" {
+		return b.webhookCustomPath
+	}
+
 	return fmt.Sprintf("%s/%s", webhookPath, b.tokenHashed)
 }
 
+// Get the webhook url which was set with SetWebhookXXX(). (empty if not set, or deleted)
+func (b *Bot) getRegisteredWebhookURL() string {
+	b.webhookLock.RLock()
+	defer b.webhookLock.RUnlock()
+
+	return b.webhookURL
+}
+
+// Get the certificate which was registered with the webhook url. (nil if none)
+func (b *Bot) getRegisteredWebhookCert() *InputFile {
+	b.webhookLock.RLock()
+	defer b.webhookLock.RUnlock()
+
+	return b.webhookCert
+}
+
+// Set the registered webhook url and its certificate.
+func (b *Bot) setRegisteredWebhook(webhookURL string, cert *InputFile) {
+	b.webhookLock.Lock()
+	defer b.webhookLock.Unlock()
+
+	b.webhookURL, b.webhookCert = webhookURL, cert
+}
+
 // Get full URL of webhook interface.
 func (b *Bot) getWebhookURL() string {
 	return fmt.Sprintf("https://%s:%d%s", b.webhookHost, b.webhookPort, b.getWebhookPath())
@@ -191,6 +257,9 @@ func (b *Bot) getWebhookURL() string {
 func (b *Bot) redact(str string) string {
 	tokenRemoved := strings.Replace(str, b.token, redactedString, -1)
 	redacted := strings.Replace(tokenRemoved, b.tokenHashed, redactedString, -1)
+	if secretToken := b.getWebhookAuth().secretToken; secretToken != "" {
+		redacted = strings.Replace(redacted, secretToken, redactedString, -1)
+	}
 	return redacted
 }
 
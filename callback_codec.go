@@ -0,0 +1,416 @@
+package telegrambot
+
+// Encoding typed payloads into signed, compact callback data
+//
+// https://core.telegram.org/bots/api#inlinekeyboardbutton
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"reflect"
+	"time"
+)
+
+const (
+	maxCallbackDataBytes = 64 // max length of callback data in bytes
+
+	callbackMACBytes        = 8 // length of truncated HMAC-SHA256 signature
+	callbackStoredKeyBytes  = 9 // length of random keys for payloads stored in Storage
+	callbackStoredKeyPrefix = "callback:"
+
+	defaultCallbackStoredTTL = 24 * time.Hour
+
+	callbackFlagInline byte = 0
+	callbackFlagStored byte = 1
+)
+
+// errors of callback codec
+var (
+	ErrCallbackDataInvalid  = errors.New("callback data: invalid or forged")
+	ErrCallbackDataExpired  = errors.New("callback data: stored payload expired")
+	ErrCallbackDataTooLarge = errors.New("callback data: payload too large (and no storage)")
+)
+
+// CallbackCodec encodes typed payloads into callback data, and decodes them back.
+//
+// Payloads are serialized in compact binary (fields in declaration order, so changing the order of fields
+// breaks the decoding of previously sent data), signed with HMAC, and encoded in base64.
+//
+// Supported types are: bool, integers, floats, string, []byte, slices, arrays, pointers, and structs of them.
+// (only exported fields of structs)
+type CallbackCodec struct {
+	secret []byte
+
+	storage   Storage
+	storedTTL time.Duration
+}
+
+// NewCallbackCodec generates a new CallbackCodec which signs callback data with given secret.
+func NewCallbackCodec(secret []byte) *CallbackCodec {
+	return &CallbackCodec{
+		secret:    append([]byte(nil), secret...),
+		storedTTL: defaultCallbackStoredTTL,
+	}
+}
+
+// NewCallbackCodec generates a new CallbackCodec with a secret derived from the bot's token.
+func (b *Bot) NewCallbackCodec() *CallbackCodec {
+	secret := sha256.Sum256([]byte("callback-data:" + b.token))
+
+	return NewCallbackCodec(secret[:])
+}
+
+// SetStorage sets a storage for payloads which are too large for callback data.
+//
+// They will be stored for given ttl, and only their short keys will be encoded in callback data.
+func (c *CallbackCodec) SetStorage(storage Storage, ttl time.Duration) *CallbackCodec {
+	c.storage = storage
+	if ttl > 0 {
+		c.storedTTL = ttl
+	}
+
+	return c
+}
+
+// Encode encodes given kind and payload into callback data. (payload can be nil)
+//
+// The kind is signed and base64-encoded along with the payload (or the key of a stored one),
+// so it can be read back only from verified data for routing. (see CallbackCodec.Kind and CallbackRouter.Kind)
+func (c *CallbackCodec) Encode(kind string, payload interface{}) (string, error) {
+	var body bytes.Buffer
+	if payload != nil {
+		if err := encodeCallbackValue(&body, reflect.ValueOf(payload)); err != nil {
+			return "", err
+		}
+	}
+
+	if data := c.sign(callbackFlagInline, kind, body.Bytes()); len(data) <= maxCallbackDataBytes {
+		return data, nil
+	}
+
+	if c.storage == nil {
+		return "", ErrCallbackDataTooLarge
+	}
+
+	// store oversize payload, and encode its key
+	key := make([]byte, callbackStoredKeyBytes)
+	if _, err := rand.Read(key); err != nil {
+		return "", fmt.Errorf("failed to generate key for callback payload: %w", err)
+	}
+	if _, err := c.storage.Set(callbackStoredKeyPrefix+base64.RawURLEncoding.EncodeToString(key), body.Bytes(), c.storedTTL); err != nil {
+		return "", fmt.Errorf("failed to store callback payload: %w", err)
+	}
+
+	data := c.sign(callbackFlagStored, kind, key)
+	if len(data) > maxCallbackDataBytes {
+		return "", fmt.Errorf("kind of callback data is too long: %s", kind)
+	}
+
+	return data, nil
+}
+
+// Decode verifies given callback data, decodes its payload into given pointer, and returns its kind.
+//
+// If payload is nil, only the kind is returned.
+func (c *CallbackCodec) Decode(data string, payload interface{}) (kind string, err error) {
+	flag, kind, body, err := c.verify(data)
+	if err != nil {
+		return "", err
+	}
+
+	if flag == callbackFlagStored {
+		key := callbackStoredKeyPrefix + base64.RawURLEncoding.EncodeToString(body)
+
+		var item *StorageItem
+		if c.storage == nil {
+			return "", ErrCallbackDataExpired
+		} else if item, err = c.storage.Get(key); err != nil {
+			return "", fmt.Errorf("failed to load callback payload: %w", err)
+		} else if item == nil {
+			return "", ErrCallbackDataExpired
+		}
+		body = item.Value
+	}
+
+	if payload != nil {
+		value := reflect.ValueOf(payload)
+		if value.Kind() != reflect.Ptr || value.IsNil() {
+			return "", fmt.Errorf("payload should be a non-nil pointer, not: %T", payload)
+		}
+
+		reader := bytes.NewReader(body)
+		if err = decodeCallbackValue(reader, value.Elem()); err != nil {
+			return "", err
+		}
+		if reader.Len() > 0 {
+			return "", fmt.Errorf("%d trailing bytes in callback payload", reader.Len())
+		}
+	}
+
+	return kind, nil
+}
+
+// Kind verifies given callback data, and returns its kind.
+func (c *CallbackCodec) Kind(data string) (string, error) {
+	_, kind, _, err := c.verify(data)
+	return kind, err
+}
+
+// InlineKeyboardButton generates an InlineKeyboardButton with encoded callback data.
+func (c *CallbackCodec) InlineKeyboardButton(text, kind string, payload interface{}) (InlineKeyboardButton, error) {
+	data, err := c.Encode(kind, payload)
+	if err != nil {
+		return InlineKeyboardButton{}, err
+	}
+
+	return InlineKeyboardButton{
+		Text:         text,
+		CallbackData: &data,
+	}, nil
+}
+
+// DecodeData decodes the callback data with given codec. (see CallbackCodec.Decode)
+func (c *Callback) DecodeData(codec *CallbackCodec, payload interface{}) (kind string, err error) {
+	return codec.Decode(c.Data, payload)
+}
+
+// Sign and encode: flag | len(kind) | kind | body | mac
+func (c *CallbackCodec) sign(flag byte, kind string, body []byte) string {
+	var buf bytes.Buffer
+	buf.WriteByte(flag)
+	writeUvarint(&buf, uint64(len(kind)))
+	buf.WriteString(kind)
+	buf.Write(body)
+	buf.Write(c.mac(buf.Bytes()))
+
+	return base64.RawURLEncoding.EncodeToString(buf.Bytes())
+}
+
+// Decode and verify callback data.
+func (c *CallbackCodec) verify(data string) (flag byte, kind string, body []byte, err error) {
+	raw, err := base64.RawURLEncoding.DecodeString(data)
+	if err != nil || len(raw) < 1+1+callbackMACBytes {
+		return 0, "", nil, ErrCallbackDataInvalid
+	}
+
+	signed, mac := raw[:len(raw)-callbackMACBytes], raw[len(raw)-callbackMACBytes:]
+	if !hmac.Equal(mac, c.mac(signed)) {
+		return 0, "", nil, ErrCallbackDataInvalid
+	}
+
+	reader := bytes.NewReader(signed)
+	flag, _ = reader.ReadByte()
+	length, err := binary.ReadUvarint(reader)
+	if err != nil || length > uint64(reader.Len()) {
+		return 0, "", nil, ErrCallbackDataInvalid
+	}
+	kindBytes := make([]byte, length)
+	_, _ = io.ReadFull(reader, kindBytes)
+	body = make([]byte, reader.Len())
+	_, _ = io.ReadFull(reader, body)
+
+	if flag != callbackFlagInline && (flag != callbackFlagStored || len(body) != callbackStoredKeyBytes) {
+		return 0, "", nil, ErrCallbackDataInvalid
+	}
+
+	return flag, string(kindBytes), body, nil
+}
+
+// Generate truncated HMAC-SHA256 of given bytes.
+func (c *CallbackCodec) mac(bytes []byte) []byte {
+	h := hmac.New(sha256.New, c.secret)
+	h.Write(bytes)
+
+	return h.Sum(nil)[:callbackMACBytes]
+}
+
+// Serialize a value in compact binary.
+func encodeCallbackValue(buf *bytes.Buffer, value reflect.Value) error {
+	switch value.Kind() {
+	case reflect.Bool:
+		if value.Bool() {
+			buf.WriteByte(1)
+		} else {
+			buf.WriteByte(0)
+		}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		var tmp [binary.MaxVarintLen64]byte
+		buf.Write(tmp[:binary.PutVarint(tmp[:], value.Int())])
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		writeUvarint(buf, value.Uint())
+	case reflect.Float32:
+		var tmp [4]byte
+		binary.BigEndian.PutUint32(tmp[:], math.Float32bits(float32(value.Float())))
+		buf.Write(tmp[:])
+	case reflect.Float64:
+		var tmp [8]byte
+		binary.BigEndian.PutUint64(tmp[:], math.Float64bits(value.Float()))
+		buf.Write(tmp[:])
+	case reflect.String:
+		writeUvarint(buf, uint64(value.Len()))
+		buf.WriteString(value.String())
+	case reflect.Slice:
+		writeUvarint(buf, uint64(value.Len()))
+		if value.Type().Elem().Kind() == reflect.Uint8 {
+			buf.Write(value.Bytes())
+			return nil
+		}
+		fallthrough
+	case reflect.Array:
+		for i := 0; i < value.Len(); i++ {
+			if err := encodeCallbackValue(buf, value.Index(i)); err != nil {
+				return err
+			}
+		}
+	case reflect.Ptr:
+		if value.IsNil() {
+			buf.WriteByte(0)
+			return nil
+		}
+		buf.WriteByte(1)
+		return encodeCallbackValue(buf, value.Elem())
+	case reflect.Struct:
+		for i := 0; i < value.NumField(); i++ {
+			if value.Type().Field(i).PkgPath != "" {
+				continue // unexported
+			}
+			if err := encodeCallbackValue(buf, value.Field(i)); err != nil {
+				return err
+			}
+		}
+	default:
+		return fmt.Errorf("unsupported type for callback payload: %s", value.Type())
+	}
+
+	return nil
+}
+
+// Deserialize a value from compact binary.
+func decodeCallbackValue(reader *bytes.Reader, value reflect.Value) (err error) {
+	switch value.Kind() {
+	case reflect.Bool:
+		var b byte
+		if b, err = reader.ReadByte(); err == nil {
+			value.SetBool(b != 0)
+		}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		var i int64
+		if i, err = binary.ReadVarint(reader); err == nil {
+			if value.OverflowInt(i) {
+				return ErrCallbackDataInvalid
+			}
+			value.SetInt(i)
+		}
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		var u uint64
+		if u, err = binary.ReadUvarint(reader); err == nil {
+			if value.OverflowUint(u) {
+				return ErrCallbackDataInvalid
+			}
+			value.SetUint(u)
+		}
+	case reflect.Float32:
+		var tmp [4]byte
+		if _, err = io.ReadFull(reader, tmp[:]); err == nil {
+			value.SetFloat(float64(math.Float32frombits(binary.BigEndian.Uint32(tmp[:]))))
+		}
+	case reflect.Float64:
+		var tmp [8]byte
+		if _, err = io.ReadFull(reader, tmp[:]); err == nil {
+			value.SetFloat(math.Float64frombits(binary.BigEndian.Uint64(tmp[:])))
+		}
+	case reflect.String:
+		var bytes []byte
+		if bytes, err = readCallbackBytes(reader); err == nil {
+			value.SetString(string(bytes))
+		}
+	case reflect.Slice:
+		if value.Type().Elem().Kind() == reflect.Uint8 {
+			var bytes []byte
+			if bytes, err = readCallbackBytes(reader); err == nil {
+				value.SetBytes(bytes)
+			}
+			break
+		}
+
+		var length uint64
+		if length, err = binary.ReadUvarint(reader); err != nil {
+			break
+		}
+		if length > uint64(reader.Len()) { // every element takes one byte at least
+			return ErrCallbackDataInvalid
+		}
+		slice := reflect.MakeSlice(value.Type(), int(length), int(length))
+		for i := 0; i < int(length); i++ {
+			if err = decodeCallbackValue(reader, slice.Index(i)); err != nil {
+				return err
+			}
+		}
+		value.Set(slice)
+	case reflect.Array:
+		for i := 0; i < value.Len(); i++ {
+			if err = decodeCallbackValue(reader, value.Index(i)); err != nil {
+				return err
+			}
+		}
+	case reflect.Ptr:
+		var b byte
+		if b, err = reader.ReadByte(); err != nil {
+			break
+		}
+		if b == 0 {
+			value.Set(reflect.Zero(value.Type()))
+			return nil
+		}
+		elem := reflect.New(value.Type().Elem())
+		if err = decodeCallbackValue(reader, elem.Elem()); err == nil {
+			value.Set(elem)
+		}
+	case reflect.Struct:
+		for i := 0; i < value.NumField(); i++ {
+			if value.Type().Field(i).PkgPath != "" {
+				continue // unexported
+			}
+			if err = decodeCallbackValue(reader, value.Field(i)); err != nil {
+				return err
+			}
+		}
+	default:
+		return fmt.Errorf("unsupported type for callback payload: %s", value.Type())
+	}
+
+	if err != nil {
+		return ErrCallbackDataInvalid
+	}
+	return nil
+}
+
+// Read length-prefixed bytes.
+func readCallbackBytes(reader *bytes.Reader) ([]byte, error) {
+	length, err := binary.ReadUvarint(reader)
+	if err != nil {
+		return nil, err
+	}
+	if length > uint64(reader.Len()) {
+		return nil, io.ErrUnexpectedEOF
+	}
+
+	bytes := make([]byte, length)
+	_, err = io.ReadFull(reader, bytes)
+
+	return bytes, err
+}
+
+// Write an unsigned varint.
+func writeUvarint(buf *bytes.Buffer, u uint64) {
+	var tmp [binary.MaxVarintLen64]byte
+	buf.Write(tmp[:binary.PutUvarint(tmp[:], u)])
+}
@@ -0,0 +1,265 @@
+package telegrambot
+
+// Routing callback queries to handlers
+//
+// https://core.telegram.org/bots/api#callbackquery
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"sync"
+)
+
+var callbackPatternPlaceholder = regexp.MustCompile(`\{([A-Za-z_][A-Za-z0-9_]*)\}`)
+
+// Callback is a struct of a callback query which is routed by CallbackRouter
+type Callback struct {
+	Query  *CallbackQuery
+	Data   string            // callback data
+	Suffix string            // callback data after the matched prefix (when routed with prefix)
+	Params map[string]string // parameters parsed with pattern (when routed with pattern)
+
+	b        *Bot
+	answered bool
+}
+
+// Answer answers the callback query.
+//
+// If not called in the handler, the callback query will be answered automatically.
+func (c *Callback) Answer(options OptionsAnswerCallbackQuery) APIResponseBool {
+	c.answered = true
+
+	return c.b.AnswerCallbackQuery(c.Query.ID, options)
+}
+
+// AnswerWithText answers the callback query with a notification text.
+func (c *Callback) AnswerWithText(text string, showAlert bool) APIResponseBool {
+	return c.Answer(OptionsAnswerCallbackQuery{}.
+		SetText(text).
+		SetShowAlert(showAlert))
+}
+
+// EditText edits the text of the message which originated the callback query.
+func (c *Callback) EditText(text string, options OptionsEditMessageText) APIResponseMessageOrBool {
+	if options == nil {
+		options = map[string]interface{}{}
+	}
+	c.setMessageIDs(options)
+
+	return c.b.EditMessageText(text, options)
+}
+
+// EditReplyMarkup edits the reply markup of the message which originated the callback query.
+func (c *Callback) EditReplyMarkup(replyMarkup InlineKeyboardMarkup) APIResponseMessageOrBool {
+	options := OptionsEditMessageReplyMarkup{}.SetReplyMarkup(replyMarkup)
+	c.setMessageIDs(options)
+
+	return c.b.EditMessageReplyMarkup(options)
+}
+
+// Set ids of the originating message to given options.
+func (c *Callback) setMessageIDs(options map[string]interface{}) {
+	if c.Query.Message != nil {
+		options["chat_id"] = c.Query.Message.Chat.ID
+		options["message_id"] = c.Query.Message.MessageID
+	} else if c.Query.InlineMessageID != nil {
+		options["inline_message_id"] = *c.Query.InlineMessageID
+	}
+}
+
+// route of callback query
+type callbackRoute struct {
+	prefix  string
+	pattern *regexp.Regexp
+	codec   *CallbackCodec
+	kind    string
+	handler func(b *Bot, update Update, cb *Callback)
+}
+
+// CallbackRouter routes callback queries to registered handlers with their data
+type CallbackRouter struct {
+	sync.RWMutex
+
+	routes      []callbackRoute
+	fallback    func(b *Bot, update Update, cb *Callback)
+	nonCallback func(b *Bot, update Update, err error)
+
+	autoAnswer bool
+}
+
+// NewCallbackRouter generates a new CallbackRouter.
+//
+// Callback queries will be answered automatically if handlers don't.
+func NewCallbackRouter() *CallbackRouter {
+	return &CallbackRouter{
+		autoAnswer: true,
+	}
+}
+
+// SetAutoAnswer sets whether to answer callback queries automatically or not.
+func (r *CallbackRouter) SetAutoAnswer(autoAnswer bool) *CallbackRouter {
+	r.Lock()
+	defer r.Unlock()
+
+	r.autoAnswer = autoAnswer
+
+	return r
+}
+
+// Prefix registers a handler for callback data which starts with given prefix.
+func (r *CallbackRouter) Prefix(prefix string, handler func(b *Bot, update Update, cb *Callback)) *CallbackRouter {
+	r.Lock()
+	defer r.Unlock()
+
+	r.routes = append(r.routes, callbackRoute{
+		prefix:  prefix,
+		handler: handler,
+	})
+
+	return r
+}
+
+// Pattern registers a handler for callback data which matches given pattern.
+//
+// Placeholders in the pattern will be parsed into Callback.Params. (eg. `vote:{id}:{choice}`)
+//
+// It panics if given pattern is invalid.
+func (r *CallbackRouter) Pattern(pattern string, handler func(b *Bot, update Update, cb *Callback)) *CallbackRouter {
+	regex, err := compileCallbackPattern(pattern)
+	if err != nil {
+		panic(err)
+	}
+
+	r.Lock()
+	defer r.Unlock()
+
+	r.routes = append(r.routes, callbackRoute{
+		pattern: regex,
+		handler: handler,
+	})
+
+	return r
+}
+
+// Kind registers a handler for callback data which was encoded by given codec with given kind.
+//
+// Forged callback data are not matched. (payload can be decoded with Callback.DecodeData)
+func (r *CallbackRouter) Kind(codec *CallbackCodec, kind string, handler func(b *Bot, update Update, cb *Callback)) *CallbackRouter {
+	r.Lock()
+	defer r.Unlock()
+
+	r.routes = append(r.routes, callbackRoute{
+		codec:   codec,
+		kind:    kind,
+		handler: handler,
+	})
+
+	return r
+}
+
+// Fallback registers a handler for callback queries which are not matched with any route.
+func (r *CallbackRouter) Fallback(handler func(b *Bot, update Update, cb *Callback)) *CallbackRouter {
+	r.Lock()
+	defer r.Unlock()
+
+	r.fallback = handler
+
+	return r
+}
+
+// NonCallback registers a handler for updates without callback queries (and errors).
+func (r *CallbackRouter) NonCallback(handler func(b *Bot, update Update, err error)) *CallbackRouter {
+	r.Lock()
+	defer r.Unlock()
+
+	r.nonCallback = handler
+
+	return r
+}
+
+// Handle routes given update to the registered handlers.
+//
+// It can be used as an update handler function. (eg. `bot.StartMonitoringUpdates(0, 1, router.Handle)`)
+func (r *CallbackRouter) Handle(b *Bot, update Update, err error) {
+	r.RLock()
+	routes, fallback, nonCallback, autoAnswer := r.routes, r.fallback, r.nonCallback, r.autoAnswer
+	r.RUnlock()
+
+	if err != nil || !update.HasCallbackQuery() {
+		if nonCallback != nil {
+			nonCallback(b, update, err)
+		}
+		return
+	}
+
+	cb := &Callback{
+		Query:  update.CallbackQuery,
+		Params: map[string]string{},
+		b:      b,
+	}
+	if update.CallbackQuery.Data != nil {
+		cb.Data = *update.CallbackQuery.Data
+	}
+
+	handler := fallback
+	for _, route := range routes {
+		if route.codec != nil {
+			if kind, err := route.codec.Kind(cb.Data); err == nil && kind == route.kind {
+				handler = route.handler
+				break
+			}
+		} else if route.pattern != nil {
+			if matches := route.pattern.FindStringSubmatch(cb.Data); matches != nil {
+				for i, name := range route.pattern.SubexpNames() {
+					if i > 0 && name != "" {
+						cb.Params[name] = matches[i]
+					}
+				}
+				handler = route.handler
+				break
+			}
+		} else if strings.HasPrefix(cb.Data, route.prefix) {
+			cb.Suffix = strings.TrimPrefix(cb.Data, route.prefix)
+			handler = route.handler
+			break
+		}
+	}
+
+	if handler != nil {
+		handler(b, update, cb)
+	} else {
+		b.verbose("no handler for callback data: %s", cb.Data)
+	}
+
+	// stop the spinner on clients
+	if autoAnswer && !cb.answered {
+		if answered := cb.Answer(nil); !answered.Ok {
+			b.error("failed to answer callback query automatically: %s", descriptionOf(answered.APIResponseBase))
+		}
+	}
+}
+
+// Compile given callback pattern into a regular expression.
+func compileCallbackPattern(pattern string) (*regexp.Regexp, error) {
+	var builder strings.Builder
+	builder.WriteString("^")
+
+	names := map[string]bool{}
+	last := 0
+	for _, loc := range callbackPatternPlaceholder.FindAllStringSubmatchIndex(pattern, -1) {
+		name := pattern[loc[2]:loc[3]]
+		if names[name] {
+			return nil, fmt.Errorf("duplicated placeholder '%s' in callback pattern: %s", name, pattern)
+		}
+		names[name] = true
+
+		builder.WriteString(regexp.QuoteMeta(pattern[last:loc[0]]))
+		builder.WriteString(fmt.Sprintf("(?P<%s>.+?)", name))
+		last = loc[1]
+	}
+	builder.WriteString(regexp.QuoteMeta(pattern[last:]))
+	builder.WriteString("$")
+
+	return regexp.Compile(builder.String())
+}
@@ -0,0 +1,227 @@
+package telegrambot
+
+// Generating self-signed certificates for webhook
+//
+// https://core.telegram.org/bots/self-signed
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math/big"
+	"net"
+	"os"
+	"time"
+)
+
+const (
+	defaultRSABits        = 2048
+	defaultCertValidity   = 365 * 24 * time.Hour
+	certFilePermission    = 0644
+	privKeyFilePermission = 0600
+)
+
+// CertKeyType is a type of private key for certificates
+type CertKeyType string
+
+// CertKeyType strings
+const (
+	CertKeyTypeRSA   CertKeyType = "rsa"
+	CertKeyTypeECDSA CertKeyType = "ecdsa" // P-256
+)
+
+// CertOptions is a struct of options for generating a self-signed certificate
+type CertOptions struct {
+	KeyType CertKeyType // default: CertKeyTypeRSA
+	RSABits int         // default: 2048
+
+	// If Subject.CommonName is empty, the first one of DNSNames or IPAddresses will be used.
+	Subject pkix.Name
+
+	DNSNames    []string
+	IPAddresses []net.IP
+
+	NotBefore time.Time     // default: now
+	ValidFor  time.Duration // default: 365 days
+}
+
+// NewCertOptions generates CertOptions for given domain name or IP address.
+func NewCertOptions(domainOrIP string, validFor time.Duration) CertOptions {
+	options := CertOptions{
+		Subject: pkix.Name{
+			CommonName: domainOrIP,
+		},
+		ValidFor: validFor,
+	}
+
+	if ip := net.ParseIP(domainOrIP); ip != nil {
+		options.IPAddresses = []net.IP{ip}
+	} else {
+		options.DNSNames = []string{domainOrIP}
+	}
+
+	return options
+}
+
+// GenCertAndKeyPEM generates a self-signed certificate and a private key in PEM format with given options.
+func GenCertAndKeyPEM(options CertOptions) (certPEM, keyPEM []byte, err error) {
+	var privateKey crypto.Signer
+	var keyBlock *pem.Block
+
+	switch options.KeyType {
+	case CertKeyTypeRSA, "":
+		bits := options.RSABits
+		if bits <= 0 {
+			bits = defaultRSABits
+		}
+
+		var key *rsa.PrivateKey
+		if key, err = rsa.GenerateKey(rand.Reader, bits); err != nil {
+			return nil, nil, fmt.Errorf("failed to generate rsa key: %w", err)
+		}
+		privateKey = key
+		keyBlock = &pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(key)}
+	case CertKeyTypeECDSA:
+		var key *ecdsa.PrivateKey
+		if key, err = ecdsa.GenerateKey(elliptic.P256(), rand.Reader); err != nil {
+			return nil, nil, fmt.Errorf("failed to generate ecdsa key: %w", err)
+		}
+		var der []byte
+		if der, err = x509.MarshalECPrivateKey(key); err != nil {
+			return nil, nil, fmt.Errorf("failed to marshal ecdsa key: %w", err)
+		}
+		privateKey = key
+		keyBlock = &pem.Block{Type: "EC PRIVATE KEY", Bytes: der}
+	default:
+		return nil, nil, fmt.Errorf("unsupported key type: '%s'", options.KeyType)
+	}
+
+	// subject
+	subject := options.Subject
+	if subject.CommonName == "" {
+		if len(options.DNSNames) > 0 {
+			subject.CommonName = options.DNSNames[0]
+		} else if len(options.IPAddresses) > 0 {
+			subject.CommonName = options.IPAddresses[0].String()
+		}
+	}
+
+	// validity period
+	notBefore := options.NotBefore
+	if notBefore.IsZero() {
+		notBefore = time.Now()
+	}
+	validFor := options.ValidFor
+	if validFor <= 0 {
+		validFor = defaultCertValidity
+	}
+
+	var serial *big.Int
+	if serial, err = rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128)); err != nil {
+		return nil, nil, fmt.Errorf("failed to generate serial number: %w", err)
+	}
+
+	template := x509.Certificate{
+		SerialNumber:          serial,
+		Subject:               subject,
+		NotBefore:             notBefore,
+		NotAfter:              notBefore.Add(validFor),
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageKeyEncipherment | x509.KeyUsageCertSign,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+		DNSNames:              options.DNSNames,
+		IPAddresses:           options.IPAddresses,
+	}
+
+	var der []byte
+	if der, err = x509.CreateCertificate(rand.Reader, &template, &template, privateKey.Public(), privateKey); err != nil {
+		return nil, nil, fmt.Errorf("failed to create certificate: %w", err)
+	}
+
+	return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), pem.EncodeToMemory(keyBlock), nil
+}
+
+// WriteCertAndKey generates a self-signed certificate and a private key with given options,
+// and writes them to given writers in PEM format.
+func WriteCertAndKey(options CertOptions, certWriter, keyWriter io.Writer) error {
+	certPEM, keyPEM, err := GenCertAndKeyPEM(options)
+	if err != nil {
+		return err
+	}
+
+	if _, err = certWriter.Write(certPEM); err != nil {
+		return fmt.Errorf("failed to write certificate: %w", err)
+	}
+	if _, err = keyWriter.Write(keyPEM); err != nil {
+		return fmt.Errorf("failed to write private key: %w", err)
+	}
+
+	return nil
+}
+
+// GenCertAndKeyWithOptions generates a self-signed certificate and a private key file with given options.
+func GenCertAndKeyWithOptions(options CertOptions, outCertFilepath string, outKeyFilepath string) error {
+	certPEM, keyPEM, err := GenCertAndKeyPEM(options)
+	if err != nil {
+		return err
+	}
+
+	if err = ioutil.WriteFile(outKeyFilepath, keyPEM, privKeyFilePermission); err != nil {
+		return fmt.Errorf("failed to write private key file: %w", err)
+	}
+	if err = ioutil.WriteFile(outCertFilepath, certPEM, certFilePermission); err != nil {
+		return fmt.Errorf("failed to write certificate file: %w", err)
+	}
+
+	return nil
+}
+
+// CertExpiresAt reads a certificate file in PEM format, and returns its expiry.
+func CertExpiresAt(certFilepath string) (time.Time, error) {
+	bytes, err := ioutil.ReadFile(certFilepath)
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	block, _ := pem.Decode(bytes)
+	if block == nil || block.Type != "CERTIFICATE" {
+		return time.Time{}, fmt.Errorf("no certificate in file: %s", certFilepath)
+	}
+
+	var cert *x509.Certificate
+	if cert, err = x509.ParseCertificate(block.Bytes); err != nil {
+		return time.Time{}, fmt.Errorf("failed to parse certificate: %w", err)
+	}
+
+	return cert.NotAfter, nil
+}
+
+// RotateCertAndKeyIfNeeded regenerates the certificate and private key file with given options
+// when the certificate does not exist, or will expire in given duration.
+//
+// Returns true if they were regenerated. (then the webhook should be registered again with the new certificate)
+func RotateCertAndKeyIfNeeded(options CertOptions, certFilepath string, keyFilepath string, renewBefore time.Duration) (rotated bool, err error) {
+	var expiresAt time.Time
+	if expiresAt, err = CertExpiresAt(certFilepath); err == nil {
+		if time.Now().Add(renewBefore).Before(expiresAt) {
+			return false, nil
+		}
+	} else if !os.IsNotExist(err) {
+		return false, err
+	}
+
+	if err = GenCertAndKeyWithOptions(options, certFilepath, keyFilepath); err != nil {
+		return false, err
+	}
+
+	return true, nil
+}
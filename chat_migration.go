@@ -0,0 +1,186 @@
+package telegrambot
+
+// Handling chat migrations (group => supergroup)
+//
+// https://core.telegram.org/bots/api#responseparameters
+
+import (
+	"bytes"
+	"encoding/json"
+	"strconv"
+	"sync"
+)
+
+// params which can have chat ids
+var chatParamKeys = []string{"chat_id", "from_chat_id"}
+
+// ChatMigrationHandler is a function which is called when a chat is migrated to a new chat id
+//
+// It can be used for remapping (or persisting) stored chat ids.
+type ChatMigrationHandler func(b *Bot, fromChatID, toChatID int64)
+
+// known chat migrations of a bot
+type chatMigrationTable struct {
+	sync.Mutex
+
+	migrations map[int64]int64 // old chat id => new chat id
+	handler    ChatMigrationHandler
+}
+
+// OnChatMigration sets a handler which is called when a chat migration is newly found,
+// from API responses (with `migrate_to_chat_id`) or updates. (see ChatMigrationMiddleware)
+func (b *Bot) OnChatMigration(handler ChatMigrationHandler) {
+	b.chatMigrations.Lock()
+	defer b.chatMigrations.Unlock()
+
+	b.chatMigrations.handler = handler
+}
+
+// AddChatMigration adds a known chat migration without calling the handler. (eg. loaded from a persistent storage)
+//
+// Requests to the old chat id will be sent to the new one.
+func (b *Bot) AddChatMigration(fromChatID, toChatID int64) {
+	b.chatMigrations.Lock()
+	defer b.chatMigrations.Unlock()
+
+	b.chatMigrations.set(fromChatID, toChatID)
+}
+
+// MigratedChatID returns the new chat id of given chat id, if it was migrated.
+func (b *Bot) MigratedChatID(chatID int64) (int64, bool) {
+	b.chatMigrations.Lock()
+	defer b.chatMigrations.Unlock()
+
+	to, exists := b.chatMigrations.migrations[chatID]
+	return to, exists
+}
+
+// ChatMigrationMiddleware calls the chat migration handler for service messages
+// with `migrate_to_chat_id` or `migrate_from_chat_id`.
+//
+// Updates are passed to the next handlers regardless of migrations.
+func ChatMigrationMiddleware() Middleware {
+	return func(next Handler) Handler {
+		return HandlerFunc(func(ctx *UpdateContext) {
+			if ctx.Err == nil {
+				if message := ctx.Update.GetMessage(); message != nil {
+					if message.MigrateToChatID != 0 {
+						ctx.Bot.migrateChat(message.Chat.ID, message.MigrateToChatID)
+					} else if message.MigrateFromChatID != 0 {
+						ctx.Bot.migrateChat(message.MigrateFromChatID, message.Chat.ID)
+					}
+				}
+			}
+
+			next.HandleUpdate(ctx)
+		})
+	}
+}
+
+// Set a migration. (should be locked)
+func (t *chatMigrationTable) set(from, to int64) bool {
+	if t.migrations == nil {
+		t.migrations = map[int64]int64{}
+	}
+	if existing, exists := t.migrations[from]; exists && existing == to {
+		return false
+	}
+	t.migrations[from] = to
+	return true
+}
+
+// Record a chat migration, and call the handler if it is a new one.
+func (b *Bot) migrateChat(from, to int64) {
+	if from == 0 || to == 0 || from == to {
+		return
+	}
+
+	b.chatMigrations.Lock()
+	isNew := b.chatMigrations.set(from, to)
+	handler := b.chatMigrations.handler
+	b.chatMigrations.Unlock()
+
+	if isNew {
+		b.verbose("chat migrated: %d => %d", from, to)
+
+		if handler != nil {
+			handler(b, from, to)
+		}
+	}
+}
+
+// Return a copy of given params with migrated chat ids replaced. (returns given params if nothing is replaced)
+func (b *Bot) replaceMigratedChatIDs(params map[string]interface{}) map[string]interface{} {
+	replaced, copied := params, false
+	for _, key := range chatParamKeys {
+		if chatID, ok := chatIDToInt64(params[key]); ok {
+			if to, migrated := b.MigratedChatID(chatID); migrated {
+				if !copied {
+					replaced, copied = copyParams(params), true
+				}
+				replaced[key] = to
+			}
+		}
+	}
+	return replaced
+}
+
+// Return the chat migration in given API response, if any.
+func migrationInResponse(resp []byte) (to int64, found bool) {
+	if !bytes.Contains(resp, []byte("migrate_to_chat_id")) {
+		return 0, false
+	}
+
+	var base APIResponseBase
+	if err := json.Unmarshal(resp, &base); err == nil && !base.Ok && base.Parameters != nil && base.Parameters.MigrateToChatID != 0 {
+		return base.Parameters.MigrateToChatID, true
+	}
+	return 0, false
+}
+
+// Return the key of the only chat param in given params. (false if there are none or several)
+func singleChatParamKey(params map[string]interface{}) (key string, found bool) {
+	for _, k := range chatParamKeys {
+		if params[k] != nil {
+			if found {
+				return "", false
+			}
+			key, found = k, true
+		}
+	}
+	return key, found
+}
+
+// Convert given chat id param into int64. (false for non-numeric ones like '@channelusername')
+func chatIDToInt64(chatID interface{}) (int64, bool) {
+	switch id := chatID.(type) {
+	case int64:
+		return id, true
+	case int:
+		return int64(id), true
+	case int32:
+		return int64(id), true
+	case float64:
+		if id == float64(int64(id)) {
+			return int64(id), true
+		}
+	case json.Number: // eg. params of scheduled jobs
+		if value, err := strconv.ParseInt(string(id), 10, 64); err == nil {
+			return value, true
+		}
+	case string:
+		if value, err := strconv.ParseInt(id, 10, 64); err == nil {
+			return value, true
+		}
+	}
+	return 0, false
+}
+
+// Return a shallow copy of given params.
+func copyParams(params map[string]interface{}) map[string]interface{} {
+	copied := make(map[string]interface{}, len(params))
+	for k, v := range params {
+		copied[k] = v
+	}
+	return copied
+}
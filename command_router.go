@@ -0,0 +1,215 @@
+package telegrambot
+
+// Routing bot commands to handlers
+//
+// https://core.telegram.org/bots#commands
+
+import (
+	"strings"
+	"sync"
+	"unicode"
+	"unicode/utf16"
+)
+
+// Command is a struct of a bot command parsed from a message
+type Command struct {
+	Name        string   // command name without leading '/' and '@botname' suffix (in lower case)
+	BotUsername string   // '@botname' suffix without '@' (empty if not given)
+	Args        []string // arguments splitted with shell-like quoting
+	RawArgs     string   // arguments as they are
+	Message     *Message // message which contains the command
+}
+
+// CommandRouter routes commands in messages to registered handlers
+type CommandRouter struct {
+	sync.RWMutex
+
+	handlers   map[string]func(b *Bot, update Update, cmd Command)
+	fallback   func(b *Bot, update Update, cmd Command)
+	nonCommand func(b *Bot, update Update, err error)
+
+	botUsername botUsernameCache
+}
+
+// NewCommandRouter generates a new CommandRouter.
+func NewCommandRouter() *CommandRouter {
+	return &CommandRouter{
+		handlers: map[string]func(b *Bot, update Update, cmd Command){},
+	}
+}
+
+// Command registers a handler for given command name. (without leading '/')
+func (r *CommandRouter) Command(name string, handler func(b *Bot, update Update, cmd Command)) *CommandRouter {
+	r.Lock()
+	defer r.Unlock()
+
+	r.handlers[strings.ToLower(strings.TrimPrefix(name, "/"))] = handler
+
+	return r
+}
+
+// Fallback registers a handler for unknown commands.
+func (r *CommandRouter) Fallback(handler func(b *Bot, update Update, cmd Command)) *CommandRouter {
+	r.Lock()
+	defer r.Unlock()
+
+	r.fallback = handler
+
+	return r
+}
+
+// NonCommand registers a handler for updates without commands (and errors).
+func (r *CommandRouter) NonCommand(handler func(b *Bot, update Update, err error)) *CommandRouter {
+	r.Lock()
+	defer r.Unlock()
+
+	r.nonCommand = handler
+
+	return r
+}
+
+// Handle routes given update to the registered handlers.
+//
+// It can be used as an update handler function. (eg. `bot.StartMonitoringUpdates(0, 1, router.Handle)`)
+func (r *CommandRouter) Handle(b *Bot, update Update, err error) {
+	if err == nil && update.HasMessage() {
+		if cmd, ok := ParseCommand(update.Message); ok {
+			if r.botUsername.isForThisBot(b, cmd) {
+				r.RLock()
+				handler, exists := r.handlers[cmd.Name]
+				if !exists {
+					handler = r.fallback
+				}
+				r.RUnlock()
+
+				if handler != nil {
+					handler(b, update, cmd)
+				}
+			} else {
+				b.verbose("ignoring command for other bot: /%s@%s", cmd.Name, cmd.BotUsername)
+			}
+			return
+		}
+	}
+
+	r.RLock()
+	nonCommand := r.nonCommand
+	r.RUnlock()
+
+	if nonCommand != nil {
+		nonCommand(b, update, err)
+	}
+}
+
+// cache of this bot's username for checking '@botname' suffix of commands
+type botUsernameCache struct {
+	sync.Mutex
+
+	username *string
+}
+
+// Check if given command is for this bot.
+func (c *botUsernameCache) isForThisBot(b *Bot, cmd Command) bool {
+	if cmd.BotUsername == "" {
+		return true
+	}
+
+	c.Lock()
+	if c.username == nil {
+		if me := b.GetMe(); me.Ok && me.Result != nil && me.Result.Username != nil {
+			username := *me.Result.Username
+			c.username = &username
+		} else {
+			c.Unlock()
+
+			b.error("failed to get username of this bot, accepting command: /%s@%s", cmd.Name, cmd.BotUsername)
+
+			return true
+		}
+	}
+	username := *c.username
+	c.Unlock()
+
+	return strings.EqualFold(cmd.BotUsername, username)
+}
+
+// ParseCommand parses a bot command at the beginning of given message. (with `bot_command` message entity)
+func ParseCommand(message *Message) (cmd Command, ok bool) {
+	if message == nil || !message.HasText() {
+		return cmd, false
+	}
+
+	for _, entity := range message.Entities {
+		if entity.Type != MessageEntityTypeBotCommand || entity.Offset != 0 {
+			continue
+		}
+
+		command := strings.TrimPrefix(message.EntityText(entity), "/")
+		if splitted := strings.SplitN(command, "@", 2); len(splitted) == 2 {
+			cmd.Name, cmd.BotUsername = splitted[0], splitted[1]
+		} else {
+			cmd.Name = command
+		}
+		cmd.Name = strings.ToLower(cmd.Name)
+		cmd.RawArgs = strings.TrimSpace(textAfterEntity(*message.Text, entity))
+		cmd.Args = SplitCommandArgs(cmd.RawArgs)
+		cmd.Message = message
+
+		return cmd, true
+	}
+
+	return cmd, false
+}
+
+// SplitCommandArgs splits given string into arguments with shell-like quoting.
+//
+// eg. `a "b c" 'd e' f\ g` => ["a", "b c", "d e", "f g"]
+//
+// An unclosed quote lasts until the end of the string.
+func SplitCommandArgs(str string) (args []string) {
+	var current strings.Builder
+	var quote rune
+	inArg, escaped := false, false
+
+	for _, r := range str {
+		switch {
+		case escaped:
+			current.WriteRune(r)
+			escaped = false
+		case r == '\\' && quote != '\'':
+			escaped, inArg = true, true
+		case quote != 0:
+			if r == quote {
+				quote = 0
+			} else {
+				current.WriteRune(r)
+			}
+		case r == '"' || r == '\'':
+			quote, inArg = r, true
+		case unicode.IsSpace(r):
+			if inArg {
+				args = append(args, current.String())
+				current.Reset()
+				inArg = false
+			}
+		default:
+			current.WriteRune(r)
+			inArg = true
+		}
+	}
+	if inArg {
+		args = append(args, current.String())
+	}
+
+	return args
+}
+
+// Get the text after given entity. (offset and length of entities are in UTF-16 code units)
+func textAfterEntity(text string, entity MessageEntity) string {
+	encoded := utf16.Encode([]rune(text))
+	if end := entity.Offset + entity.Length; end < len(encoded) {
+		return string(utf16.Decode(encoded[end:]))
+	}
+
+	return ""
+}
@@ -0,0 +1,511 @@
+package telegrambot
+
+// Multi-step conversations as state machines (per chat and user)
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	defaultCancelCommand = "cancel"
+)
+
+// Conversation is a struct of an ongoing conversation which is passed to state handlers
+type Conversation struct {
+	ChatID int64
+	UserID int
+
+	b       *Bot
+	flow    *ConversationFlow
+	update  Update
+	state   string
+	data    map[string]string
+	ended   bool
+	entered map[string]bool // states entered while handling the current update
+}
+
+// State returns the current state of the conversation.
+func (c *Conversation) State() string {
+	return c.state
+}
+
+// Get returns the data value for given key.
+func (c *Conversation) Get(key string) string {
+	return c.data[key]
+}
+
+// Set sets the data value for given key.
+func (c *Conversation) Set(key, value string) {
+	if c.data == nil {
+		c.data = map[string]string{}
+	}
+	c.data[key] = value
+}
+
+// Data returns all data values of the conversation.
+func (c *Conversation) Data() map[string]string {
+	return copyConversationData(c.data)
+}
+
+// Transition changes the state of the conversation, and calls OnEnter handler of the new state.
+func (c *Conversation) Transition(state string) {
+	c.state, c.ended = state, false
+
+	if c.entered[state] {
+		c.b.error("not entering state '%s' again while handling the same update", state)
+		return
+	}
+	c.entered[state] = true
+
+	if def := c.flow.stateDef(state); def != nil {
+		if def.onEnter != nil {
+			def.onEnter(c.b, c.update, c)
+		}
+	} else {
+		c.b.error("transition to undeclared conversation state: '%s'", state)
+	}
+}
+
+// End ends the conversation. (its state will be deleted)
+func (c *Conversation) End() {
+	c.ended = true
+}
+
+// ConversationStateDef is a declaration of a conversation state
+type ConversationStateDef struct {
+	name           string
+	timeoutSeconds int
+
+	onEnter    func(b *Bot, update Update, conv *Conversation)
+	onMessage  func(b *Bot, update Update, conv *Conversation)
+	onCallback func(b *Bot, update Update, conv *Conversation)
+	onCommands map[string]func(b *Bot, update Update, conv *Conversation, cmd Command)
+}
+
+// Timeout sets the timeout of this state in seconds. (overrides the flow's timeout, 0 for the flow's)
+func (d *ConversationStateDef) Timeout(seconds int) *ConversationStateDef {
+	d.timeoutSeconds = seconds
+	return d
+}
+
+// OnEnter sets a handler which is called when the conversation enters this state. (eg. for sending a prompt)
+func (d *ConversationStateDef) OnEnter(handler func(b *Bot, update Update, conv *Conversation)) *ConversationStateDef {
+	d.onEnter = handler
+	return d
+}
+
+// OnMessage sets a handler for messages (not commands) in this state.
+func (d *ConversationStateDef) OnMessage(handler func(b *Bot, update Update, conv *Conversation)) *ConversationStateDef {
+	d.onMessage = handler
+	return d
+}
+
+// OnCallback sets a handler for callback queries in this state.
+//
+// Callback queries should be answered in the handler.
+func (d *ConversationStateDef) OnCallback(handler func(b *Bot, update Update, conv *Conversation)) *ConversationStateDef {
+	d.onCallback = handler
+	return d
+}
+
+// OnCommand sets a handler for given command in this state.
+func (d *ConversationStateDef) OnCommand(name string, handler func(b *Bot, update Update, conv *Conversation, cmd Command)) *ConversationStateDef {
+	d.onCommands[strings.ToLower(strings.TrimPrefix(name, "/"))] = handler
+	return d
+}
+
+// ConversationFlow routes updates to the states of ongoing conversations
+type ConversationFlow struct {
+	sync.RWMutex
+
+	store          ConversationStore
+	states         map[string]*ConversationStateDef
+	entries        map[string]string // command => initial state
+	cancelCommands map[string]bool
+	timeoutSeconds int
+
+	onCancel        func(b *Bot, update Update, conv *Conversation)
+	onTimeout       func(b *Bot, conv *Conversation)
+	nonConversation func(b *Bot, update Update, err error)
+
+	botUsername botUsernameCache
+	locks       conversationLocks // for handling updates of each conversation one by one
+}
+
+// NewConversationFlow generates a new ConversationFlow which saves states with given store.
+//
+// `/cancel` command cancels ongoing conversations by default.
+func NewConversationFlow(store ConversationStore) *ConversationFlow {
+	return &ConversationFlow{
+		store:          store,
+		states:         map[string]*ConversationStateDef{},
+		entries:        map[string]string{},
+		cancelCommands: map[string]bool{defaultCancelCommand: true},
+	}
+}
+
+// State declares a state with given name, and returns its declaration for setting handlers.
+func (f *ConversationFlow) State(name string) *ConversationStateDef {
+	f.Lock()
+	defer f.Unlock()
+
+	if def, exists := f.states[name]; exists {
+		return def
+	}
+
+	def := &ConversationStateDef{
+		name:       name,
+		onCommands: map[string]func(b *Bot, update Update, conv *Conversation, cmd Command){},
+	}
+	f.states[name] = def
+
+	return def
+}
+
+// Entry registers a command which starts a conversation with given state.
+func (f *ConversationFlow) Entry(command, state string) *ConversationFlow {
+	f.Lock()
+	defer f.Unlock()
+
+	f.entries[strings.ToLower(strings.TrimPrefix(command, "/"))] = state
+
+	return f
+}
+
+// SetCancelCommands replaces the commands which cancel ongoing conversations. (default: `/cancel`)
+func (f *ConversationFlow) SetCancelCommands(commands ...string) *ConversationFlow {
+	f.Lock()
+	defer f.Unlock()
+
+	f.cancelCommands = map[string]bool{}
+	for _, command := range commands {
+		f.cancelCommands[strings.ToLower(strings.TrimPrefix(command, "/"))] = true
+	}
+
+	return f
+}
+
+// SetTimeout sets the default timeout of states in seconds. (0 for no timeout)
+func (f *ConversationFlow) SetTimeout(seconds int) *ConversationFlow {
+	f.Lock()
+	defer f.Unlock()
+
+	f.timeoutSeconds = seconds
+
+	return f
+}
+
+// OnCancel sets a handler which is called when a conversation is cancelled.
+func (f *ConversationFlow) OnCancel(handler func(b *Bot, update Update, conv *Conversation)) *ConversationFlow {
+	f.Lock()
+	defer f.Unlock()
+
+	f.onCancel = handler
+
+	return f
+}
+
+// OnTimeout sets a handler which is called when a conversation is expired.
+func (f *ConversationFlow) OnTimeout(handler func(b *Bot, conv *Conversation)) *ConversationFlow {
+	f.Lock()
+	defer f.Unlock()
+
+	f.onTimeout = handler
+
+	return f
+}
+
+// NonConversation sets a handler for updates which are not handled by conversations (and errors).
+func (f *ConversationFlow) NonConversation(handler func(b *Bot, update Update, err error)) *ConversationFlow {
+	f.Lock()
+	defer f.Unlock()
+
+	f.nonConversation = handler
+
+	return f
+}
+
+// Handle routes given update to the state handlers of its conversation.
+//
+// It can be used as an update handler function. (eg. `bot.StartMonitoringUpdates(0, 1, flow.Handle)`)
+func (f *ConversationFlow) Handle(b *Bot, update Update, err error) {
+	if err != nil || !f.handle(b, update) {
+		f.RLock()
+		nonConversation := f.nonConversation
+		f.RUnlock()
+
+		if nonConversation != nil {
+			nonConversation(b, update, err)
+		}
+	}
+}
+
+// HandleUpdate routes the update in given context. (implements Handler)
+func (f *ConversationFlow) HandleUpdate(ctx *UpdateContext) {
+	f.Handle(ctx.Bot, ctx.Update, ctx.Err)
+}
+
+// Start starts a conversation with given state for given chat and user.
+//
+// (eg. for starting conversations from other handlers)
+//
+// It should not be called from the state handlers of the same conversation. (use Conversation.Transition instead)
+func (f *ConversationFlow) Start(b *Bot, update Update, chatID int64, userID int, state string) error {
+	defer f.locks.lock(conversationKey(chatID, userID))()
+
+	return f.start(b, update, chatID, userID, state)
+}
+
+// Start a conversation. (conversation lock should be held)
+func (f *ConversationFlow) start(b *Bot, update Update, chatID int64, userID int, state string) error {
+	conv := f.newConversation(b, update, chatID, userID, nil)
+	conv.Transition(state)
+
+	return f.save(conv)
+}
+
+// ExpireConversations deletes the conversations which are timed out, and calls OnTimeout handler for them.
+//
+// Timed out conversations are also expired when their next updates arrive,
+// so call this periodically only when users should be notified of timeouts without sending anything.
+func (f *ConversationFlow) ExpireConversations(b *Bot) error {
+	states, err := f.store.ListConversations()
+	if err != nil {
+		return fmt.Errorf("failed to list conversations: %w", err)
+	}
+
+	for key, state := range states {
+		if f.isExpired(state) {
+			f.expireIfNotUpdated(b, key)
+		}
+	}
+
+	return nil
+}
+
+// Expire the conversation for given key, if it is still timed out. (it could be updated after listed)
+func (f *ConversationFlow) expireIfNotUpdated(b *Bot, key string) {
+	defer f.locks.lock(key)()
+
+	state, err := f.store.LoadConversation(key)
+	if err != nil {
+		b.error("failed to load conversation: %s", err)
+		return
+	}
+	if state != nil && f.isExpired(*state) {
+		f.expire(b, key, *state)
+	}
+}
+
+// Handle given update, and return true if it was handled by a conversation.
+func (f *ConversationFlow) handle(b *Bot, update Update) bool {
+	chat, from := update.GetChat(), update.GetFrom()
+	if chat == nil || from == nil {
+		return false
+	}
+	key := conversationKey(chat.ID, from.ID)
+
+	// load, step, and save without being interleaved with other updates of the same conversation
+	defer f.locks.lock(key)()
+
+	state, err := f.store.LoadConversation(key)
+	if err != nil {
+		b.error("failed to load conversation: %s", err)
+		return false
+	}
+	if state != nil && f.isExpired(*state) {
+		f.expire(b, key, *state)
+		state = nil
+	}
+
+	cmd, isCommand := ParseCommand(update.Message)
+	if isCommand && !f.botUsername.isForThisBot(b, cmd) {
+		isCommand = false
+	}
+
+	f.RLock()
+	entryState, isEntry := f.entries[cmd.Name]
+	isCancel := f.cancelCommands[cmd.Name]
+	onCancel := f.onCancel
+	f.RUnlock()
+
+	// cancel
+	if isCommand && isCancel && state != nil {
+		conv := f.newConversation(b, update, chat.ID, from.ID, state)
+		if err := f.store.DeleteConversation(key); err != nil {
+			b.error("failed to delete cancelled conversation: %s", err)
+		}
+		if onCancel != nil {
+			onCancel(b, update, conv)
+		}
+		return true
+	}
+
+	// (re)start
+	if isCommand && isEntry {
+		if err := f.start(b, update, chat.ID, from.ID, entryState); err != nil {
+			b.error("failed to save started conversation: %s", err)
+		}
+		return true
+	}
+
+	if state == nil {
+		return false
+	}
+
+	def := f.stateDef(state.State)
+	if def == nil {
+		b.error("conversation is in undeclared state: '%s'", state.State)
+		return false
+	}
+
+	conv := f.newConversation(b, update, chat.ID, from.ID, state)
+	switch {
+	case isCommand:
+		if handler, exists := def.onCommands[cmd.Name]; exists {
+			handler(b, update, conv, cmd)
+		} else {
+			return false
+		}
+	case update.HasCallbackQuery():
+		if def.onCallback != nil {
+			def.onCallback(b, update, conv)
+		} else {
+			return false
+		}
+	case update.GetMessage() != nil:
+		if def.onMessage != nil {
+			def.onMessage(b, update, conv)
+		} else {
+			return false
+		}
+	default:
+		return false
+	}
+
+	if err := f.save(conv); err != nil {
+		b.error("failed to save conversation: %s", err)
+	}
+
+	return true
+}
+
+// Generate a conversation from given state.
+func (f *ConversationFlow) newConversation(b *Bot, update Update, chatID int64, userID int, state *ConversationState) *Conversation {
+	conv := &Conversation{
+		ChatID:  chatID,
+		UserID:  userID,
+		b:       b,
+		flow:    f,
+		update:  update,
+		entered: map[string]bool{},
+	}
+	if state != nil {
+		conv.state, conv.data = state.State, state.Data
+		conv.entered[state.State] = true
+	}
+	return conv
+}
+
+// Save (or delete, if ended) given conversation.
+func (f *ConversationFlow) save(conv *Conversation) error {
+	key := conversationKey(conv.ChatID, conv.UserID)
+
+	if conv.ended {
+		return f.store.DeleteConversation(key)
+	}
+
+	return f.store.SaveConversation(key, ConversationState{
+		ChatID:    conv.ChatID,
+		UserID:    conv.UserID,
+		State:     conv.state,
+		Data:      conv.data,
+		UpdatedAt: time.Now(),
+	})
+}
+
+// Delete given timed out conversation, and call OnTimeout handler.
+func (f *ConversationFlow) expire(b *Bot, key string, state ConversationState) {
+	b.verbose("conversation timed out in state '%s': %s", state.State, key)
+
+	if err := f.store.DeleteConversation(key); err != nil {
+		b.error("failed to delete timed out conversation: %s", err)
+	}
+
+	f.RLock()
+	onTimeout := f.onTimeout
+	f.RUnlock()
+
+	if onTimeout != nil {
+		onTimeout(b, f.newConversation(b, Update{}, state.ChatID, state.UserID, &state))
+	}
+}
+
+// Check if given state is timed out.
+func (f *ConversationFlow) isExpired(state ConversationState) bool {
+	f.RLock()
+	timeoutSeconds := f.timeoutSeconds
+	if def, exists := f.states[state.State]; exists && def.timeoutSeconds > 0 {
+		timeoutSeconds = def.timeoutSeconds
+	}
+	f.RUnlock()
+
+	return timeoutSeconds > 0 && time.Since(state.UpdatedAt) > time.Duration(timeoutSeconds)*time.Second
+}
+
+// Get the declaration of given state.
+func (f *ConversationFlow) stateDef(state string) *ConversationStateDef {
+	f.RLock()
+	defer f.RUnlock()
+
+	return f.states[state]
+}
+
+// Key of a conversation in stores.
+func conversationKey(chatID int64, userID int) string {
+	return fmt.Sprintf("%d:%d", chatID, userID)
+}
+
+// locks of conversations by their keys
+type conversationLocks struct {
+	sync.Mutex
+
+	locks map[string]*conversationLock
+}
+
+// a lock of a conversation, with the number of its holders and waiters
+type conversationLock struct {
+	sync.Mutex
+
+	refs int
+}
+
+// Lock the conversation for given key, and return a function for unlocking it.
+func (l *conversationLocks) lock(key string) (unlock func()) {
+	l.Lock()
+	if l.locks == nil {
+		l.locks = map[string]*conversationLock{}
+	}
+	lock, exists := l.locks[key]
+	if !exists {
+		lock = &conversationLock{}
+		l.locks[key] = lock
+	}
+	lock.refs++
+	l.Unlock()
+
+	lock.Lock()
+
+	return func() {
+		lock.Unlock()
+
+		l.Lock()
+		if lock.refs--; lock.refs == 0 {
+			delete(l.locks, key)
+		}
+		l.Unlock()
+	}
+}
@@ -0,0 +1,137 @@
+package telegrambot
+
+// Stores for saving states of conversations
+
+import (
+	"sync"
+	"time"
+)
+
+// ConversationState is a struct of a conversation's state which is saved in ConversationStore
+type ConversationState struct {
+	ChatID    int64             `json:"chat_id"`
+	UserID    int               `json:"user_id"`
+	State     string            `json:"state"`
+	Data      map[string]string `json:"data,omitempty"`
+	UpdatedAt time.Time         `json:"updated_at"`
+}
+
+// ConversationStore is an interface for saving states of conversations
+type ConversationStore interface {
+	// LoadConversation returns the state for given key. (nil if not exists)
+	LoadConversation(key string) (*ConversationState, error)
+
+	// SaveConversation saves the state for given key.
+	SaveConversation(key string, state ConversationState) error
+
+	// DeleteConversation deletes the state for given key.
+	DeleteConversation(key string) error
+
+	// ListConversations returns all saved states with their keys.
+	ListConversations() (map[string]ConversationState, error)
+}
+
+// MemoryConversationStore is a ConversationStore which keeps states in memory
+//
+// States will be lost on restarts.
+type MemoryConversationStore struct {
+	sync.RWMutex
+
+	states map[string]ConversationState
+}
+
+// NewMemoryConversationStore generates a new MemoryConversationStore.
+func NewMemoryConversationStore() *MemoryConversationStore {
+	return &MemoryConversationStore{
+		states: map[string]ConversationState{},
+	}
+}
+
+// LoadConversation returns the state for given key. (nil if not exists)
+func (s *MemoryConversationStore) LoadConversation(key string) (*ConversationState, error) {
+	s.RLock()
+	defer s.RUnlock()
+
+	if state, exists := s.states[key]; exists {
+		state.Data = copyConversationData(state.Data)
+		return &state, nil
+	}
+	return nil, nil
+}
+
+// SaveConversation saves the state for given key.
+func (s *MemoryConversationStore) SaveConversation(key string, state ConversationState) error {
+	s.Lock()
+	defer s.Unlock()
+
+	state.Data = copyConversationData(state.Data)
+	s.states[key] = state
+
+	return nil
+}
+
+// DeleteConversation deletes the state for given key.
+func (s *MemoryConversationStore) DeleteConversation(key string) error {
+	s.Lock()
+	defer s.Unlock()
+
+	delete(s.states, key)
+
+	return nil
+}
+
+// ListConversations returns all saved states with their keys.
+func (s *MemoryConversationStore) ListConversations() (map[string]ConversationState, error) {
+	s.RLock()
+	defer s.RUnlock()
+
+	states := map[string]ConversationState{}
+	for key, state := range s.states {
+		state.Data = copyConversationData(state.Data)
+		states[key] = state
+	}
+
+	return states, nil
+}
+
+// FileConversationStore is a ConversationStore which keeps states in a FileStorage
+//
+// States survive restarts and crashes. (see StorageConversationStore for other storages)
+type FileConversationStore struct {
+	*StorageConversationStore
+
+	storage *FileStorage
+}
+
+// NewFileConversationStore generates a new FileConversationStore with given file.
+//
+// Saved states will be loaded if the file exists.
+func NewFileConversationStore(filepath string) (*FileConversationStore, error) {
+	storage, err := NewFileStorage(filepath)
+	if err != nil {
+		return nil, err
+	}
+
+	return &FileConversationStore{
+		StorageConversationStore: NewStorageConversationStore(storage),
+		storage:                  storage,
+	}, nil
+}
+
+// Close closes the file of the store.
+func (s *FileConversationStore) Close() error {
+	return s.storage.Close()
+}
+
+// Copy data of a conversation.
+func copyConversationData(data map[string]string) map[string]string {
+	if data == nil {
+		return nil
+	}
+
+	copied := map[string]string{}
+	for key, value := range data {
+		copied[key] = value
+	}
+	return copied
+}
@@ -0,0 +1,219 @@
+package telegrambot
+
+// Parsing cron expressions for scheduled jobs
+//
+// https://en.wikipedia.org/wiki/Cron#CRON_expression
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	maxCronSearchYears = 5 // give up finding the next time after this many years (eg. `0 0 30 2 *`)
+)
+
+var cronMacros = map[string]string{
+	"@yearly":   "0 0 1 1 *",
+	"@annually": "0 0 1 1 *",
+	"@monthly":  "0 0 1 * *",
+	"@weekly":   "0 0 * * 0",
+	"@daily":    "0 0 * * *",
+	"@midnight": "0 0 * * *",
+	"@hourly":   "0 * * * *",
+}
+
+var cronMonthNames = map[string]int{
+	"jan": 1, "feb": 2, "mar": 3, "apr": 4, "may": 5, "jun": 6,
+	"jul": 7, "aug": 8, "sep": 9, "oct": 10, "nov": 11, "dec": 12,
+}
+
+var cronWeekdayNames = map[string]int{
+	"sun": 0, "mon": 1, "tue": 2, "wed": 3, "thu": 4, "fri": 5, "sat": 6,
+}
+
+// CronSchedule is a parsed cron expression
+type CronSchedule struct {
+	minutes, hours, days, months, weekdays uint64 // bit sets
+
+	anyDay, anyWeekday bool // for day-of-month/day-of-week semantics
+}
+
+// ParseCron parses a cron expression with 5 fields. (minute, hour, day of month, month, and day of week)
+//
+// Supports: `*`, lists (`1,2`), ranges (`1-5`), steps (`*/15`, `1-30/2`), names (`jan`, `mon`),
+// and macros (`@yearly`, `@monthly`, `@weekly`, `@daily`, `@hourly`).
+//
+// When both day of month and day of week are restricted, a day matching either of them matches. (like crontab)
+func ParseCron(expr string) (*CronSchedule, error) {
+	expr = strings.TrimSpace(expr)
+	if macro, exists := cronMacros[strings.ToLower(expr)]; exists {
+		expr = macro
+	}
+
+	fields := strings.Fields(expr)
+	if len(fields) != 5 {
+		return nil, fmt.Errorf("cron expression should have 5 fields: '%s'", expr)
+	}
+
+	var err error
+	schedule := &CronSchedule{
+		anyDay:     strings.HasPrefix(fields[2], "*"),
+		anyWeekday: strings.HasPrefix(fields[4], "*"),
+	}
+	if schedule.minutes, err = parseCronField(fields[0], 0, 59, nil); err != nil {
+		return nil, fmt.Errorf("invalid minute field: %w", err)
+	}
+	if schedule.hours, err = parseCronField(fields[1], 0, 23, nil); err != nil {
+		return nil, fmt.Errorf("invalid hour field: %w", err)
+	}
+	if schedule.days, err = parseCronField(fields[2], 1, 31, nil); err != nil {
+		return nil, fmt.Errorf("invalid day of month field: %w", err)
+	}
+	if schedule.months, err = parseCronField(fields[3], 1, 12, cronMonthNames); err != nil {
+		return nil, fmt.Errorf("invalid month field: %w", err)
+	}
+	if schedule.weekdays, err = parseCronField(fields[4], 0, 7, cronWeekdayNames); err != nil {
+		return nil, fmt.Errorf("invalid day of week field: %w", err)
+	}
+	if schedule.weekdays&(1<<7) != 0 { // 7 is also sunday
+		schedule.weekdays |= 1
+	}
+
+	return schedule, nil
+}
+
+// Next returns the first time matching the schedule after given time. (zero if not found)
+//
+// The schedule is evaluated in the location of given time.
+// Times skipped by daylight saving transitions do not match, and times repeated by them match only once.
+func (s *CronSchedule) Next(after time.Time) time.Time {
+	loc := after.Location()
+	t := after.Truncate(time.Minute).Add(time.Minute).In(loc)
+	limit := after.AddDate(maxCronSearchYears, 0, 0)
+
+	for t.Before(limit) {
+		if s.months&(1<<uint(t.Month())) == 0 {
+			t = advanceCronTime(t, time.Date(t.Year(), t.Month()+1, 1, 0, 0, 0, 0, loc))
+			continue
+		}
+		if !s.matchesDay(t) {
+			t = advanceCronTime(t, time.Date(t.Year(), t.Month(), t.Day()+1, 0, 0, 0, 0, loc))
+			continue
+		}
+		if s.hours&(1<<uint(t.Hour())) == 0 {
+			t = nextCronHour(t)
+			continue
+		}
+		if s.minutes&(1<<uint(t.Minute())) == 0 || repeatedWallClock(t) {
+			t = t.Add(time.Minute)
+			continue
+		}
+		return t
+	}
+
+	return time.Time{}
+}
+
+// Advance given time to next, or to the next hour if next is not after it.
+//
+// (time.Date normalizes wall clocks which do not exist, eg. in daylight saving gaps, to possibly earlier times)
+func advanceCronTime(t, next time.Time) time.Time {
+	if next.After(t) {
+		return next
+	}
+	return nextCronHour(t)
+}
+
+// Return the start of the next hour of given time, in absolute time. (for not being stuck in daylight saving gaps)
+func nextCronHour(t time.Time) time.Time {
+	return t.Add(-time.Duration(t.Minute()) * time.Minute).Add(time.Hour)
+}
+
+// Check if the wall clock of given time was already passed before a backward daylight saving transition.
+// (eg. 01:30 EST after 01:30 EDT)
+func repeatedWallClock(t time.Time) bool {
+	_, offset := t.Zone()
+	_, previousOffset := t.Add(-2 * time.Hour).Zone() // transitions shift clocks by at most 2 hours
+	if previousOffset <= offset {
+		return false
+	}
+
+	earlier := t.Add(-time.Duration(previousOffset-offset) * time.Second)
+	return earlier.Day() == t.Day() && earlier.Hour() == t.Hour() && earlier.Minute() == t.Minute()
+}
+
+// Check if the day of given time matches.
+func (s *CronSchedule) matchesDay(t time.Time) bool {
+	day := s.days&(1<<uint(t.Day())) != 0
+	weekday := s.weekdays&(1<<uint(t.Weekday())) != 0
+
+	switch {
+	case s.anyDay && s.anyWeekday:
+		return true
+	case s.anyDay:
+		return weekday
+	case s.anyWeekday:
+		return day
+	}
+	return day || weekday
+}
+
+// Parse a field into a bit set.
+func parseCronField(field string, min, max int, names map[string]int) (bits uint64, err error) {
+	for _, part := range strings.Split(field, ",") {
+		rangeStr, step := part, 1
+		if i := strings.Index(part, "/"); i >= 0 {
+			rangeStr = part[:i]
+			if step, err = strconv.Atoi(part[i+1:]); err != nil || step <= 0 {
+				return 0, fmt.Errorf("invalid step: '%s'", part)
+			}
+		}
+
+		var from, to int
+		switch {
+		case rangeStr == "*":
+			from, to = min, max
+		case strings.Contains(rangeStr, "-"):
+			bounds := strings.SplitN(rangeStr, "-", 2)
+			if from, err = parseCronValue(bounds[0], names); err != nil {
+				return 0, err
+			}
+			if to, err = parseCronValue(bounds[1], names); err != nil {
+				return 0, err
+			}
+		default:
+			if from, err = parseCronValue(rangeStr, names); err != nil {
+				return 0, err
+			}
+			to = from
+			if step > 1 { // `5/10` means from 5 to max
+				to = max
+			}
+		}
+
+		if from < min || to > max || from > to {
+			return 0, fmt.Errorf("out of range [%d-%d]: '%s'", min, max, part)
+		}
+		for v := from; v <= to; v += step {
+			bits |= 1 << uint(v)
+		}
+	}
+
+	return bits, nil
+}
+
+// Parse a number or a name.
+func parseCronValue(str string, names map[string]int) (int, error) {
+	if value, exists := names[strings.ToLower(str)]; exists {
+		return value, nil
+	}
+
+	value, err := strconv.Atoi(str)
+	if err != nil {
+		return 0, fmt.Errorf("invalid value: '%s'", str)
+	}
+	return value, nil
+}
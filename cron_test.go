@@ -0,0 +1,140 @@
+package telegrambot
+
+import (
+	"testing"
+	"time"
+)
+
+// load a location for tests, or skip if tzdata is not available
+func loadTestLocation(t *testing.T, name string) *time.Location {
+	loc, err := time.LoadLocation(name)
+	if err != nil {
+		t.Skipf("location '%s' is not available: %s", name, err)
+	}
+	return loc
+}
+
+func TestParseCron(t *testing.T) {
+	valid := []string{
+		"* * * * *",
+		"*/15 * * * *",
+		"0 9-17/2 * * mon-fri",
+		"5,10,15 0 1 jan,JUL *",
+		"0 0 * * 7",
+		"5/10 * * * *",
+		"@daily",
+		"@Weekly",
+		"0 0 30 2 *", // valid, but never matches
+	}
+	for _, expr := range valid {
+		if _, err := ParseCron(expr); err != nil {
+			t.Errorf("expected '%s' to be parsed, but got error: %s", expr, err)
+		}
+	}
+
+	invalid := []string{
+		"",
+		"* * * *",
+		"* * * * * *",
+		"60 * * * *",
+		"* 24 * * *",
+		"* * 0 * *",
+		"* * 32 * *",
+		"* * * 13 *",
+		"* * * * 8",
+		"*/0 * * * *",
+		"*/x * * * *",
+		"5-1 * * * *",
+		"* * * foo *",
+		"@never",
+	}
+	for _, expr := range invalid {
+		if _, err := ParseCron(expr); err == nil {
+			t.Errorf("expected '%s' to be rejected", expr)
+		}
+	}
+}
+
+func TestCronScheduleNext(t *testing.T) {
+	utc := time.UTC
+
+	tests := []struct {
+		expr     string
+		after    time.Time
+		expected time.Time // zero for no match
+	}{
+		// every minute
+		{"* * * * *", time.Date(2026, 1, 1, 0, 0, 30, 0, utc), time.Date(2026, 1, 1, 0, 1, 0, 0, utc)},
+		// steps
+		{"*/15 * * * *", time.Date(2026, 1, 1, 10, 16, 0, 0, utc), time.Date(2026, 1, 1, 10, 30, 0, 0, utc)},
+		{"5/20 * * * *", time.Date(2026, 1, 1, 10, 26, 0, 0, utc), time.Date(2026, 1, 1, 10, 45, 0, 0, utc)},
+		// ranges with steps, and names (2026-01-02 is a friday)
+		{"0 9-17/4 * * mon-fri", time.Date(2026, 1, 2, 17, 0, 0, 0, utc), time.Date(2026, 1, 5, 9, 0, 0, 0, utc)},
+		// month names
+		{"0 0 1 jul *", time.Date(2026, 1, 1, 0, 0, 0, 0, utc), time.Date(2026, 7, 1, 0, 0, 0, 0, utc)},
+		// 7 is sunday (2026-01-04 is a sunday)
+		{"0 0 * * 7", time.Date(2026, 1, 1, 0, 0, 0, 0, utc), time.Date(2026, 1, 4, 0, 0, 0, 0, utc)},
+		// day of month or day of week (like crontab)
+		{"0 0 15 * mon", time.Date(2026, 1, 6, 0, 0, 0, 0, utc), time.Date(2026, 1, 12, 0, 0, 0, 0, utc)},
+		// leap day
+		{"0 0 29 2 *", time.Date(2026, 1, 1, 0, 0, 0, 0, utc), time.Date(2028, 2, 29, 0, 0, 0, 0, utc)},
+		// macros
+		{"@monthly", time.Date(2026, 12, 31, 23, 59, 0, 0, utc), time.Date(2027, 1, 1, 0, 0, 0, 0, utc)},
+		// impossible dates
+		{"0 0 30 2 *", time.Date(2026, 1, 1, 0, 0, 0, 0, utc), time.Time{}},
+		{"0 0 31 4,6,9,11 *", time.Date(2026, 1, 1, 0, 0, 0, 0, utc), time.Time{}},
+	}
+
+	for _, test := range tests {
+		schedule, err := ParseCron(test.expr)
+		if err != nil {
+			t.Fatalf("failed to parse '%s': %s", test.expr, err)
+		}
+		if next := schedule.Next(test.after); !next.Equal(test.expected) {
+			t.Errorf("'%s' after %s: expected %s, got %s", test.expr, test.after, test.expected, next)
+		}
+	}
+}
+
+func TestCronScheduleNextDaylightSaving(t *testing.T) {
+	ny := loadTestLocation(t, "America/New_York")
+
+	tests := []struct {
+		name     string
+		expr     string
+		after    time.Time
+		expected time.Time
+	}{
+		// spring-forward (2026-03-08 02:00 EST => 03:00 EDT): 02:30 does not exist on that day
+		{"skipped time", "30 2 * * *", time.Date(2026, 3, 7, 12, 0, 0, 0, ny), time.Date(2026, 3, 9, 2, 30, 0, 0, ny)},
+		{"after gap", "0 3 * * *", time.Date(2026, 3, 7, 12, 0, 0, 0, ny), time.Date(2026, 3, 8, 3, 0, 0, 0, ny)},
+		{"hourly over gap", "15 * * * *", time.Date(2026, 3, 8, 1, 30, 0, 0, ny), time.Date(2026, 3, 8, 3, 15, 0, 0, ny)},
+		{"skipped day hour", "0 2 8 3 *", time.Date(2026, 3, 1, 0, 0, 0, 0, ny), time.Date(2027, 3, 8, 2, 0, 0, 0, ny)},
+
+		// fall-back (2026-11-01 02:00 EDT => 01:00 EST): 01:30 happens twice, but matches once
+		{"repeated time", "30 1 * * *", time.Date(2026, 10, 31, 12, 0, 0, 0, ny), time.Date(2026, 11, 1, 5, 30, 0, 0, time.UTC)},
+		{"after repeated time", "30 1 * * *", time.Date(2026, 11, 1, 5, 30, 0, 0, time.UTC).In(ny), time.Date(2026, 11, 2, 1, 30, 0, 0, ny)},
+		{"after fall-back", "0 2 * * *", time.Date(2026, 11, 1, 0, 0, 0, 0, ny), time.Date(2026, 11, 1, 2, 0, 0, 0, ny)},
+	}
+
+	for _, test := range tests {
+		schedule, err := ParseCron(test.expr)
+		if err != nil {
+			t.Fatalf("failed to parse '%s': %s", test.expr, err)
+		}
+
+		done := make(chan time.Time, 1)
+		go func() {
+			done <- schedule.Next(test.after)
+		}()
+
+		select {
+		case next := <-done:
+			if !next.Equal(test.expected) {
+				t.Errorf("%s: '%s' after %s: expected %s, got %s", test.name, test.expr, test.after, test.expected, next)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatalf("%s: '%s' after %s did not return", test.name, test.expr, test.after)
+		}
+	}
+}
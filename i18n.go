@@ -0,0 +1,519 @@
+package telegrambot
+
+// Localizing messages with catalogs and User.LanguageCode
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+)
+
+// context keys for values which are set by built-in middleware
+const (
+	ContextKeyLocale = "locale" // string, set by Localizer.Middleware
+)
+
+const (
+	localeKeyPrefix = "locale:"
+)
+
+var i18nPlaceholder = regexp.MustCompile(`\{([A-Za-z_][A-Za-z0-9_]*)\}`)
+
+// PluralCategory is a category of plural forms
+//
+// http://cldr.unicode.org/index/cldr-spec/plural-rules
+type PluralCategory string
+
+// PluralCategory strings
+const (
+	PluralZero  PluralCategory = "zero"
+	PluralOne   PluralCategory = "one"
+	PluralTwo   PluralCategory = "two"
+	PluralFew   PluralCategory = "few"
+	PluralMany  PluralCategory = "many"
+	PluralOther PluralCategory = "other"
+)
+
+// PluralRule is a function which returns the plural category of given count
+type PluralRule func(count int) PluralCategory
+
+// built-in plural rules (by base language)
+var defaultPluralRules = map[string]PluralRule{
+	"en": pluralRuleOneOther,
+	"de": pluralRuleOneOther,
+	"es": pluralRuleOneOther,
+	"it": pluralRuleOneOther,
+	"nl": pluralRuleOneOther,
+	"pt": pluralRuleFrench,
+	"fr": pluralRuleFrench,
+	"ko": pluralRuleOther,
+	"ja": pluralRuleOther,
+	"zh": pluralRuleOther,
+	"vi": pluralRuleOther,
+	"th": pluralRuleOther,
+	"id": pluralRuleOther,
+	"ru": pluralRuleEastSlavic,
+	"uk": pluralRuleEastSlavic,
+	"be": pluralRuleEastSlavic,
+	"pl": pluralRulePolish,
+	"cs": pluralRuleCzech,
+	"sk": pluralRuleCzech,
+}
+
+// a localized message (plain, or with plural forms)
+type i18nMessage struct {
+	text   string
+	plural map[PluralCategory]string
+}
+
+// Localizer translates messages with catalogs of locales
+//
+// Messages can have named placeholders (eg. `Hello, {name}!`), and plural forms which are selected
+// with the `count` argument. (eg. `{"one": "{count} apple", "other": "{count} apples"}`)
+type Localizer struct {
+	defaultLocale string
+
+	sync.RWMutex
+	catalogs    map[string]map[string]i18nMessage // locale => key => message
+	pluralRules map[string]PluralRule
+	storage     Storage // for user overrides
+}
+
+// NewLocalizer generates a new Localizer with given default locale.
+func NewLocalizer(defaultLocale string) *Localizer {
+	rules := map[string]PluralRule{}
+	for lang, rule := range defaultPluralRules {
+		rules[lang] = rule
+	}
+
+	return &Localizer{
+		defaultLocale: normalizeLocale(defaultLocale),
+		catalogs:      map[string]map[string]i18nMessage{},
+		pluralRules:   rules,
+	}
+}
+
+// SetPluralRule sets the plural rule of given language. (eg. "en")
+func (l *Localizer) SetPluralRule(lang string, rule PluralRule) *Localizer {
+	l.Lock()
+	defer l.Unlock()
+
+	l.pluralRules[normalizeLocale(lang)] = rule
+
+	return l
+}
+
+// SetStorage sets a storage for saving locales of users. (see SetUserLocale)
+func (l *Localizer) SetStorage(storage Storage) *Localizer {
+	l.Lock()
+	defer l.Unlock()
+
+	l.storage = storage
+
+	return l
+}
+
+// AddMessages adds messages of given locale.
+//
+// Values should be strings, or maps of plural forms. Other maps are treated as namespaces of keys.
+// (eg. `{"menu": {"start": "Start"}}` => key: `menu.start`)
+func (l *Localizer) AddMessages(locale string, messages map[string]interface{}) error {
+	flattened := map[string]i18nMessage{}
+	if err := flattenI18nMessages("", messages, flattened); err != nil {
+		return err
+	}
+
+	locale = normalizeLocale(locale)
+
+	l.Lock()
+	defer l.Unlock()
+
+	catalog, exists := l.catalogs[locale]
+	if !exists {
+		catalog = map[string]i18nMessage{}
+		l.catalogs[locale] = catalog
+	}
+	for key, message := range flattened {
+		catalog[key] = message
+	}
+
+	return nil
+}
+
+// LoadFile loads messages of given locale from a JSON (.json) or TOML (.toml) file.
+func (l *Localizer) LoadFile(locale, path string) error {
+	bytes, err := ioutil.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("failed to read catalog file: %w", err)
+	}
+
+	var messages map[string]interface{}
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".json":
+		err = json.Unmarshal(bytes, &messages)
+	case ".toml":
+		messages, err = parseTOML(string(bytes))
+	default:
+		return fmt.Errorf("unsupported catalog file: %s", path)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to parse catalog file %s: %w", path, err)
+	}
+
+	return l.AddMessages(locale, messages)
+}
+
+// LoadDir loads all catalog files in given directory, with their names as locales. (eg. `en.json`, `ko.toml`)
+func (l *Localizer) LoadDir(dir string) error {
+	files, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return fmt.Errorf("failed to read catalog directory: %w", err)
+	}
+
+	for _, file := range files {
+		ext := strings.ToLower(filepath.Ext(file.Name()))
+		if file.IsDir() || (ext != ".json" && ext != ".toml") {
+			continue
+		}
+
+		if err = l.LoadFile(strings.TrimSuffix(file.Name(), filepath.Ext(file.Name())), filepath.Join(dir, file.Name())); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// SetUserLocale saves the locale of given user in storage. (empty locale for deleting it)
+func (l *Localizer) SetUserLocale(userID int, locale string) error {
+	l.RLock()
+	storage := l.storage
+	l.RUnlock()
+
+	if storage == nil {
+		return fmt.Errorf("no storage for user locales")
+	}
+
+	key := fmt.Sprintf("%s%d", localeKeyPrefix, userID)
+	if locale == "" {
+		return storage.Delete(key)
+	}
+
+	_, err := storage.Set(key, []byte(normalizeLocale(locale)), 0)
+	return err
+}
+
+// Locale resolves the locale of given update.
+//
+// (saved locale of the user => User.LanguageCode => default locale)
+func (l *Localizer) Locale(update Update) string {
+	from := update.GetFrom()
+	if from == nil {
+		return l.defaultLocale
+	}
+
+	l.RLock()
+	storage := l.storage
+	l.RUnlock()
+
+	if storage != nil {
+		if item, err := storage.Get(fmt.Sprintf("%s%d", localeKeyPrefix, from.ID)); err == nil && item != nil {
+			return string(item.Value)
+		}
+	}
+
+	if from.LanguageCode != nil {
+		if locale := l.supportedLocale(*from.LanguageCode); locale != "" {
+			return locale
+		}
+	}
+
+	return l.defaultLocale
+}
+
+// Translate translates given key in given locale with arguments.
+//
+// It falls back to the base language (eg. "en" for "en-us"), then the default locale, then the key itself.
+func (l *Localizer) Translate(locale, key string, args map[string]interface{}) string {
+	locale = normalizeLocale(locale)
+
+	l.RLock()
+	message, found := l.lookup(locale, key)
+	rule := l.pluralRule(locale)
+	l.RUnlock()
+
+	if !found {
+		return key
+	}
+
+	text := message.text
+	if message.plural != nil {
+		count, _ := toInt(args["count"])
+		if zero, exists := message.plural[PluralZero]; exists && count == 0 {
+			text = zero // explicit form for zero
+		} else if text = message.plural[rule(count)]; text == "" {
+			text = message.plural[PluralOther]
+		}
+	}
+
+	return i18nPlaceholder.ReplaceAllStringFunc(text, func(placeholder string) string {
+		if value, exists := args[placeholder[1:len(placeholder)-1]]; exists {
+			return fmt.Sprint(value)
+		}
+		return placeholder
+	})
+}
+
+// T translates given key in the locale of given update with arguments. (can be nil)
+func (l *Localizer) T(update Update, key string, args map[string]interface{}) string {
+	return l.Translate(l.Locale(update), key, args)
+}
+
+// Has checks if given key exists in given locale. (or its fallbacks)
+func (l *Localizer) Has(locale, key string) bool {
+	l.RLock()
+	defer l.RUnlock()
+
+	_, found := l.lookup(normalizeLocale(locale), key)
+	return found
+}
+
+// LocalizeInlineKeyboard translates texts of inline keyboard buttons as keys. (texts which are not keys are left as they are)
+func (l *Localizer) LocalizeInlineKeyboard(update Update, markup InlineKeyboardMarkup) InlineKeyboardMarkup {
+	locale := l.Locale(update)
+
+	localized := InlineKeyboardMarkup{}
+	for _, row := range markup.InlineKeyboard {
+		buttons := []InlineKeyboardButton{}
+		for _, button := range row {
+			button.Text = l.translateLabel(locale, button.Text)
+			buttons = append(buttons, button)
+		}
+		localized.InlineKeyboard = append(localized.InlineKeyboard, buttons)
+	}
+
+	return localized
+}
+
+// LocalizeReplyKeyboard translates texts of keyboard buttons as keys. (texts which are not keys are left as they are)
+func (l *Localizer) LocalizeReplyKeyboard(update Update, markup ReplyKeyboardMarkup) ReplyKeyboardMarkup {
+	locale := l.Locale(update)
+
+	localized := markup
+	localized.Keyboard = nil
+	for _, row := range markup.Keyboard {
+		buttons := []KeyboardButton{}
+		for _, button := range row {
+			button.Text = l.translateLabel(locale, button.Text)
+			buttons = append(buttons, button)
+		}
+		localized.Keyboard = append(localized.Keyboard, buttons)
+	}
+
+	return localized
+}
+
+// Middleware returns a middleware which resolves the locale of each update, and sets it to the context.
+func (l *Localizer) Middleware() Middleware {
+	return func(next Handler) Handler {
+		return HandlerFunc(func(ctx *UpdateContext) {
+			if ctx.Err == nil {
+				ctx.Set(ContextKeyLocale, l.Locale(ctx.Update))
+			}
+
+			next.HandleUpdate(ctx)
+		})
+	}
+}
+
+// Translate a label if it is a key.
+func (l *Localizer) translateLabel(locale, label string) string {
+	if l.Has(locale, label) {
+		return l.Translate(locale, label, nil)
+	}
+	return label
+}
+
+// Find a supported locale for given language code. (empty if not supported)
+func (l *Localizer) supportedLocale(languageCode string) string {
+	locale := normalizeLocale(languageCode)
+
+	l.RLock()
+	defer l.RUnlock()
+
+	if _, exists := l.catalogs[locale]; exists {
+		return locale
+	}
+	if base := baseLanguage(locale); base != locale {
+		if _, exists := l.catalogs[base]; exists {
+			return base
+		}
+	}
+	return ""
+}
+
+// Look up a message with fallbacks. (read lock should be held)
+func (l *Localizer) lookup(locale, key string) (i18nMessage, bool) {
+	for _, candidate := range []string{locale, baseLanguage(locale), l.defaultLocale} {
+		if message, exists := l.catalogs[candidate][key]; exists {
+			return message, true
+		}
+	}
+	return i18nMessage{}, false
+}
+
+// Get the plural rule of given locale. (read lock should be held)
+func (l *Localizer) pluralRule(locale string) PluralRule {
+	if rule, exists := l.pluralRules[locale]; exists {
+		return rule
+	}
+	if rule, exists := l.pluralRules[baseLanguage(locale)]; exists {
+		return rule
+	}
+	return pluralRuleOneOther
+}
+
+// Flatten nested messages into keys with dots.
+func flattenI18nMessages(prefix string, messages map[string]interface{}, flattened map[string]i18nMessage) error {
+	for key, value := range messages {
+		fullKey := prefix + key
+
+		switch v := value.(type) {
+		case string:
+			flattened[fullKey] = i18nMessage{text: v}
+		case map[string]interface{}:
+			if plural, ok := pluralForms(v); ok {
+				flattened[fullKey] = i18nMessage{plural: plural}
+			} else if err := flattenI18nMessages(fullKey+".", v, flattened); err != nil {
+				return err
+			}
+		default:
+			return fmt.Errorf("unsupported value for message '%s': %v", fullKey, value)
+		}
+	}
+
+	return nil
+}
+
+// Check if given map is of plural forms.
+func pluralForms(values map[string]interface{}) (map[PluralCategory]string, bool) {
+	plural := map[PluralCategory]string{}
+	for key, value := range values {
+		text, isString := value.(string)
+		switch category := PluralCategory(key); category {
+		case PluralZero, PluralOne, PluralTwo, PluralFew, PluralMany, PluralOther:
+			if !isString {
+				return nil, false
+			}
+			plural[category] = text
+		default:
+			return nil, false
+		}
+	}
+	if _, exists := plural[PluralOther]; !exists {
+		return nil, false
+	}
+	return plural, true
+}
+
+// Normalize a locale. (eg. "en_US" => "en-us")
+func normalizeLocale(locale string) string {
+	return strings.ToLower(strings.Replace(strings.TrimSpace(locale), "_", "-", -1))
+}
+
+// Get the base language of a locale. (eg. "en-us" => "en")
+func baseLanguage(locale string) string {
+	if i := strings.Index(locale, "-"); i > 0 {
+		return locale[:i]
+	}
+	return locale
+}
+
+// Convert a number to int.
+func toInt(value interface{}) (int, bool) {
+	switch v := value.(type) {
+	case int:
+		return v, true
+	case int8:
+		return int(v), true
+	case int16:
+		return int(v), true
+	case int32:
+		return int(v), true
+	case int64:
+		return int(v), true
+	case uint:
+		return int(v), true
+	case uint8:
+		return int(v), true
+	case uint16:
+		return int(v), true
+	case uint32:
+		return int(v), true
+	case uint64:
+		return int(v), true
+	case float32:
+		return int(v), true
+	case float64:
+		return int(v), true
+	}
+	return 0, false
+}
+
+////////////////////////////////
+// Built-in plural rules
+//
+
+func pluralRuleOther(count int) PluralCategory {
+	return PluralOther
+}
+
+func pluralRuleOneOther(count int) PluralCategory {
+	if count == 1 {
+		return PluralOne
+	}
+	return PluralOther
+}
+
+func pluralRuleFrench(count int) PluralCategory {
+	if count == 0 || count == 1 {
+		return PluralOne
+	}
+	return PluralOther
+}
+
+func pluralRuleEastSlavic(count int) PluralCategory {
+	mod10, mod100 := count%10, count%100
+	switch {
+	case mod10 == 1 && mod100 != 11:
+		return PluralOne
+	case mod10 >= 2 && mod10 <= 4 && (mod100 < 12 || mod100 > 14):
+		return PluralFew
+	}
+	return PluralMany
+}
+
+func pluralRulePolish(count int) PluralCategory {
+	mod10, mod100 := count%10, count%100
+	switch {
+	case count == 1:
+		return PluralOne
+	case mod10 >= 2 && mod10 <= 4 && (mod100 < 12 || mod100 > 14):
+		return PluralFew
+	}
+	return PluralMany
+}
+
+func pluralRuleCzech(count int) PluralCategory {
+	switch {
+	case count == 1:
+		return PluralOne
+	case count >= 2 && count <= 4:
+		return PluralFew
+	}
+	return PluralOther
+}
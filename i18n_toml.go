@@ -0,0 +1,235 @@
+package telegrambot
+
+// Minimal TOML parser for message catalogs
+//
+// Supports: comments, [tables] (with dotted names), key/value pairs with bare, quoted, or dotted keys,
+// and basic ("..."), literal ('...'), or multi-line ("""...""") string values.
+//
+// https://toml.io/en/v1.0.0
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Parse TOML text into nested maps.
+func parseTOML(text string) (map[string]interface{}, error) {
+	root := map[string]interface{}{}
+	table := root
+
+	lines := strings.Split(strings.Replace(text, "\r\n", "\n", -1), "\n")
+	for i := 0; i < len(lines); i++ {
+		lineNum := i + 1
+		line := strings.TrimSpace(lines[i])
+
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		// table
+		if strings.HasPrefix(line, "[") {
+			if strings.HasPrefix(line, "[[") {
+				return nil, fmt.Errorf("line %d: arrays of tables are not supported", lineNum)
+			}
+			end := strings.Index(line, "]")
+			if end < 0 || !isTOMLComment(line[end+1:]) {
+				return nil, fmt.Errorf("line %d: invalid table header", lineNum)
+			}
+
+			keys, rest, err := parseTOMLKey(line[1:end])
+			if err != nil || strings.TrimSpace(rest) != "" {
+				return nil, fmt.Errorf("line %d: invalid table name", lineNum)
+			}
+			if table, err = tomlTable(root, keys); err != nil {
+				return nil, fmt.Errorf("line %d: %s", lineNum, err)
+			}
+			continue
+		}
+
+		// key = value
+		keys, rest, err := parseTOMLKey(line)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %s", lineNum, err)
+		}
+		rest = strings.TrimSpace(rest)
+		if !strings.HasPrefix(rest, "=") {
+			return nil, fmt.Errorf("line %d: expected '='", lineNum)
+		}
+		rest = strings.TrimSpace(rest[1:])
+
+		var value string
+		if strings.HasPrefix(rest, `"""`) {
+			// multi-line string: consume following lines until closing quotes
+			raw := rest[3:]
+			for !strings.Contains(raw, `"""`) {
+				i++
+				if i >= len(lines) {
+					return nil, fmt.Errorf("line %d: unclosed multi-line string", lineNum)
+				}
+				raw += "\n" + lines[i]
+			}
+			end := strings.Index(raw, `"""`)
+			if !isTOMLComment(raw[end+3:]) {
+				return nil, fmt.Errorf("line %d: unexpected characters after string", lineNum)
+			}
+			raw = strings.TrimPrefix(raw[:end], "\n") // newline right after opening quotes is trimmed
+			if value, err = unescapeTOMLString(raw); err != nil {
+				return nil, fmt.Errorf("line %d: %s", lineNum, err)
+			}
+		} else {
+			var remaining string
+			if value, remaining, err = parseTOMLString(rest); err != nil {
+				return nil, fmt.Errorf("line %d: %s", lineNum, err)
+			}
+			if !isTOMLComment(remaining) {
+				return nil, fmt.Errorf("line %d: unexpected characters after string", lineNum)
+			}
+		}
+
+		parent, err := tomlTable(table, keys[:len(keys)-1])
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %s", lineNum, err)
+		}
+		last := keys[len(keys)-1]
+		if _, exists := parent[last]; exists {
+			return nil, fmt.Errorf("line %d: duplicated key '%s'", lineNum, last)
+		}
+		parent[last] = value
+	}
+
+	return root, nil
+}
+
+// Get (or create) a nested table with given keys.
+func tomlTable(table map[string]interface{}, keys []string) (map[string]interface{}, error) {
+	for _, key := range keys {
+		switch child := table[key].(type) {
+		case nil:
+			created := map[string]interface{}{}
+			table[key] = created
+			table = created
+		case map[string]interface{}:
+			table = child
+		default:
+			return nil, fmt.Errorf("key '%s' is not a table", key)
+		}
+	}
+	return table, nil
+}
+
+// Parse a (dotted) key, and return the remaining string.
+func parseTOMLKey(str string) (keys []string, rest string, err error) {
+	rest = str
+	for {
+		rest = strings.TrimLeft(rest, " \t")
+
+		var key string
+		if strings.HasPrefix(rest, `"`) || strings.HasPrefix(rest, `'`) {
+			if key, rest, err = parseTOMLString(rest); err != nil {
+				return nil, "", err
+			}
+		} else {
+			end := 0
+			for end < len(rest) && isTOMLBareKeyChar(rest[end]) {
+				end++
+			}
+			if end == 0 {
+				return nil, "", fmt.Errorf("invalid key")
+			}
+			key, rest = rest[:end], rest[end:]
+		}
+		keys = append(keys, key)
+
+		rest = strings.TrimLeft(rest, " \t")
+		if !strings.HasPrefix(rest, ".") {
+			return keys, rest, nil
+		}
+		rest = rest[1:]
+	}
+}
+
+// Parse a single-line basic or literal string, and return the remaining string.
+func parseTOMLString(str string) (value, rest string, err error) {
+	if strings.HasPrefix(str, `'`) {
+		end := strings.Index(str[1:], `'`)
+		if end < 0 {
+			return "", "", fmt.Errorf("unclosed literal string")
+		}
+		return str[1 : end+1], str[end+2:], nil
+	}
+
+	if !strings.HasPrefix(str, `"`) {
+		return "", "", fmt.Errorf("values other than strings are not supported")
+	}
+	for i := 1; i < len(str); i++ {
+		switch str[i] {
+		case '\\':
+			i++ // skip escaped character
+		case '"':
+			value, err = unescapeTOMLString(str[1:i])
+			return value, str[i+1:], err
+		}
+	}
+	return "", "", fmt.Errorf("unclosed string")
+}
+
+// Unescape a basic string.
+func unescapeTOMLString(str string) (string, error) {
+	var builder strings.Builder
+	for i := 0; i < len(str); i++ {
+		if str[i] != '\\' {
+			builder.WriteByte(str[i])
+			continue
+		}
+
+		i++
+		if i >= len(str) {
+			return "", fmt.Errorf("invalid escape at the end of string")
+		}
+		switch str[i] {
+		case 'b':
+			builder.WriteByte('\b')
+		case 't':
+			builder.WriteByte('\t')
+		case 'n':
+			builder.WriteByte('\n')
+		case 'f':
+			builder.WriteByte('\f')
+		case 'r':
+			builder.WriteByte('\r')
+		case '"':
+			builder.WriteByte('"')
+		case '\\':
+			builder.WriteByte('\\')
+		case 'u', 'U':
+			size := 4
+			if str[i] == 'U' {
+				size = 8
+			}
+			if i+1+size > len(str) {
+				return "", fmt.Errorf("invalid unicode escape")
+			}
+			code, err := strconv.ParseUint(str[i+1:i+1+size], 16, 32)
+			if err != nil {
+				return "", fmt.Errorf("invalid unicode escape: %s", err)
+			}
+			builder.WriteRune(rune(code))
+			i += size
+		default:
+			return "", fmt.Errorf("invalid escape: \\%c", str[i])
+		}
+	}
+	return builder.String(), nil
+}
+
+// Check if given string is empty or a comment.
+func isTOMLComment(str string) bool {
+	str = strings.TrimSpace(str)
+	return str == "" || strings.HasPrefix(str, "#")
+}
+
+// Check if given character can be in bare keys.
+func isTOMLBareKeyChar(c byte) bool {
+	return (c >= 'A' && c <= 'Z') || (c >= 'a' && c <= 'z') || (c >= '0' && c <= '9') || c == '_' || c == '-'
+}
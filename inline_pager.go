@@ -0,0 +1,218 @@
+package telegrambot
+
+// Paginating answers of inline queries with InlineQuery.Offset
+//
+// https://core.telegram.org/bots/api#answerinlinequery
+
+import (
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"hash/crc32"
+	"sync"
+	"time"
+)
+
+const (
+	maxInlineQueryResults       = 50 // max number of results in an answer
+	maxInlineQueryResultIDBytes = 64 // max length of a result's id in bytes
+
+	maxInt = int(^uint(0) >> 1)
+)
+
+// InlineResultSource is a function which returns results of given query from offset, at most limit items.
+//
+// hasMore should be true if there are more results after the returned ones.
+type InlineResultSource func(query string, offset, limit int) (results []interface{}, hasMore bool, err error)
+
+// a page of inline query results
+type inlineResultPage struct {
+	results    []interface{}
+	nextOffset int // 0 for no more results
+	expiresAt  time.Time
+}
+
+// InlinePager answers inline queries with paginated results from a source
+type InlinePager struct {
+	source   InlineResultSource
+	pageSize int
+
+	sync.Mutex
+	cacheTTL time.Duration
+	cache    map[string]inlineResultPage
+}
+
+// NewInlinePager generates a new InlinePager with given source and page size. (at most 50)
+func NewInlinePager(source InlineResultSource, pageSize int) *InlinePager {
+	if pageSize <= 0 || pageSize > maxInlineQueryResults {
+		pageSize = maxInlineQueryResults
+	}
+
+	return &InlinePager{
+		source:   source,
+		pageSize: pageSize,
+		cache:    map[string]inlineResultPage{},
+	}
+}
+
+// SetCacheTTL sets the TTL of cached result pages in seconds. (0 for no caching)
+func (p *InlinePager) SetCacheTTL(seconds int) *InlinePager {
+	p.Lock()
+	defer p.Unlock()
+
+	p.cacheTTL = time.Duration(seconds) * time.Second
+	if p.cacheTTL <= 0 {
+		p.cache = map[string]inlineResultPage{}
+	}
+
+	return p
+}
+
+// Answer answers given inline query with the page at its offset.
+//
+// Results with empty, duplicated, or too long (> 64 bytes) ids are dropped,
+// and `next_offset` of given options will be overwritten.
+func (p *InlinePager) Answer(b *Bot, query InlineQuery, options OptionsAnswerInlineQuery) (result APIResponseBool) {
+	page, err := p.page(query.Query, decodeInlineOffset(query.Query, query.Offset))
+	if err != nil {
+		errStr := err.Error()
+		return APIResponseBool{APIResponseBase: APIResponseBase{Ok: false, Description: &errStr}}
+	}
+
+	if options == nil {
+		options = map[string]interface{}{}
+	}
+	options = options.SetNextOffset(page.nextOffsetString(query.Query))
+
+	// drop invalid results
+	results := []interface{}{}
+	ids := map[string]bool{}
+	for _, res := range page.results {
+		id, err := inlineQueryResultID(res)
+		if err != nil {
+			b.error("dropping inline query result: %s", err)
+			continue
+		}
+		if ids[id] {
+			b.error("dropping inline query result with duplicated id: %s", id)
+			continue
+		}
+		ids[id] = true
+		results = append(results, res)
+	}
+
+	return b.AnswerInlineQuery(query.ID, results, options)
+}
+
+// Page returns the results at given opaque offset of the query. (from cache if possible)
+func (p *InlinePager) Page(query, offset string) (results []interface{}, nextOffset string, err error) {
+	page, err := p.page(query, decodeInlineOffset(query, offset))
+	if err != nil {
+		return nil, "", err
+	}
+	return page.results, page.nextOffsetString(query), nil
+}
+
+// Get a page at given offset.
+func (p *InlinePager) page(query string, offset int) (inlineResultPage, error) {
+	cacheKey := fmt.Sprintf("%d:%s", offset, query)
+	now := time.Now()
+
+	p.Lock()
+	cacheTTL := p.cacheTTL
+	if page, exists := p.cache[cacheKey]; exists {
+		if now.Before(page.expiresAt) {
+			p.Unlock()
+			return page, nil
+		}
+		delete(p.cache, cacheKey)
+	}
+	p.Unlock()
+
+	results, hasMore, err := p.source(query, offset, p.pageSize)
+	if err != nil {
+		return inlineResultPage{}, fmt.Errorf("failed to get inline query results: %w", err)
+	}
+	if len(results) > p.pageSize {
+		results, hasMore = results[:p.pageSize], true
+	}
+
+	page := inlineResultPage{
+		results: results,
+	}
+	if hasMore && len(results) > 0 {
+		page.nextOffset = offset + len(results)
+	}
+
+	if cacheTTL > 0 {
+		page.expiresAt = now.Add(cacheTTL)
+
+		p.Lock()
+		for key, cached := range p.cache { // prune expired pages
+			if !now.Before(cached.expiresAt) {
+				delete(p.cache, key)
+			}
+		}
+		p.cache[cacheKey] = page
+		p.Unlock()
+	}
+
+	return page, nil
+}
+
+// Get the opaque next offset of a page.
+func (page inlineResultPage) nextOffsetString(query string) string {
+	if page.nextOffset <= 0 {
+		return ""
+	}
+	return encodeInlineOffset(query, page.nextOffset)
+}
+
+// Encode an offset into an opaque cursor, bound to the query.
+func encodeInlineOffset(query string, offset int) string {
+	buf := make([]byte, 4+binary.MaxVarintLen64)
+	binary.BigEndian.PutUint32(buf, crc32.ChecksumIEEE([]byte(query)))
+	n := binary.PutUvarint(buf[4:], uint64(offset))
+
+	return base64.RawURLEncoding.EncodeToString(buf[:4+n])
+}
+
+// Decode an opaque cursor into an offset. (0 if it is invalid or not for the query)
+func decodeInlineOffset(query, cursor string) int {
+	buf, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil || len(buf) < 5 {
+		return 0
+	}
+	if binary.BigEndian.Uint32(buf) != crc32.ChecksumIEEE([]byte(query)) {
+		return 0
+	}
+
+	offset, n := binary.Uvarint(buf[4:])
+	if n <= 0 || offset > uint64(maxInt) {
+		return 0
+	}
+	return int(offset)
+}
+
+// Get the id of an inline query result, and check its length.
+func inlineQueryResultID(result interface{}) (string, error) {
+	bytes, err := json.Marshal(result)
+	if err != nil {
+		return "", fmt.Errorf("failed to serialize result: %w", err)
+	}
+
+	var res InlineQueryResult
+	if err = json.Unmarshal(bytes, &res); err != nil {
+		return "", fmt.Errorf("failed to get id of result: %w", err)
+	}
+
+	if res.ID == "" {
+		return "", fmt.Errorf("result has no id")
+	}
+	if len(res.ID) > maxInlineQueryResultIDBytes {
+		return "", fmt.Errorf("id of result is longer than %d bytes: %s", maxInlineQueryResultIDBytes, res.ID)
+	}
+
+	return res.ID, nil
+}
@@ -0,0 +1,103 @@
+package telegrambot
+
+// Uploading new files in InputMedia with `attach://<name>`
+//
+// https://core.telegram.org/bots/api#sending-files
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+const (
+	maxMediaGroupItems = 10 // max number of media in a media group
+
+	attachPrefix = "attach://"
+)
+
+// MarshalJSON marshals InputMedia with its media (and thumb) as strings.
+//
+// New files are referenced as 'attach://<name>', so they should be prepared with their multipart names before marshaling.
+func (m InputMedia) MarshalJSON() ([]byte, error) {
+	type inputMedia InputMedia // for avoiding recursion
+
+	media, err := m.Media.mediaReference(m.mediaAttachName)
+	if err != nil {
+		return nil, err
+	}
+	var thumb string
+	if m.Thumb != nil {
+		if thumb, err = m.Thumb.mediaReference(m.thumbAttachName); err != nil {
+			return nil, err
+		}
+	}
+
+	return json.Marshal(struct {
+		inputMedia
+		Media string `json:"media"`
+		Thumb string `json:"thumb,omitempty"`
+	}{
+		inputMedia: inputMedia(m),
+		Media:      media,
+		Thumb:      thumb,
+	})
+}
+
+// Check if given InputFile should be uploaded as a new file.
+func (f InputFile) isNewFile() bool {
+	return len(f.Bytes) > 0 || f.Filepath != nil
+}
+
+// Return the string for referencing given InputFile in InputMedia.
+func (f InputFile) mediaReference(attachName string) (string, error) {
+	if f.isNewFile() {
+		if attachName == "" {
+			return "", fmt.Errorf("new file in InputMedia is not attached")
+		}
+		return attachPrefix + attachName, nil
+	}
+	if f.URL != nil {
+		return *f.URL, nil
+	}
+	if f.FileID != nil {
+		return *f.FileID, nil
+	}
+	return "", fmt.Errorf("InputFile in InputMedia has no file id, url, or new file")
+}
+
+// Attach new files of given media to params as multipart parts,
+// and return the copied media which reference them. (eg. 'attach://file0', 'attach://thumb0')
+func attachInputMedia(media []InputMedia, params map[string]interface{}) []InputMedia {
+	attached := make([]InputMedia, len(media))
+	for i, m := range media {
+		if m.Media.isNewFile() {
+			m.mediaAttachName = fmt.Sprintf("file%d", i)
+			params[m.mediaAttachName] = m.Media
+		}
+		if m.Thumb != nil && m.Thumb.isNewFile() {
+			m.thumbAttachName = fmt.Sprintf("thumb%d", i)
+			params[m.thumbAttachName] = *m.Thumb
+		}
+		attached[i] = m
+	}
+	return attached
+}
+
+// Split given media into groups with 2-10 items, as evenly as possible. (eg. 11 => 6 + 5)
+func chunkMediaGroup(media []InputMedia) [][]InputMedia {
+	if len(media) <= maxMediaGroupItems {
+		return [][]InputMedia{media}
+	}
+
+	num := (len(media) + maxMediaGroupItems - 1) / maxMediaGroupItems
+	chunks := [][]InputMedia{}
+	for i, start := 0, 0; i < num; i++ {
+		size := len(media) / num
+		if i < len(media)%num {
+			size++
+		}
+		chunks = append(chunks, media[start:start+size])
+		start += size
+	}
+	return chunks
+}
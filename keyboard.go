@@ -0,0 +1,307 @@
+package telegrambot
+
+// Builders for ordered keyboards
+//
+// https://core.telegram.org/bots/api#inlinekeyboardmarkup
+// https://core.telegram.org/bots/api#replykeyboardmarkup
+
+import (
+	"fmt"
+)
+
+////////////////////////////////
+// Inline keyboard
+//
+
+// InlineKeyboardBuilder is a builder for InlineKeyboardMarkup
+type InlineKeyboardBuilder struct {
+	rows    [][]InlineKeyboardButton
+	columns int
+	err     error
+}
+
+// NewInlineKeyboardBuilder generates a new InlineKeyboardBuilder.
+func NewInlineKeyboardBuilder() *InlineKeyboardBuilder {
+	return &InlineKeyboardBuilder{
+		rows: [][]InlineKeyboardButton{{}},
+	}
+}
+
+// Columns sets the number of columns: following buttons are wrapped into a new row automatically
+// when the current row has given number of buttons. (0 for no wrapping)
+func (k *InlineKeyboardBuilder) Columns(columns int) *InlineKeyboardBuilder {
+	if columns < 0 {
+		columns = 0
+	}
+	k.columns = columns
+	return k
+}
+
+// Row starts a new row.
+func (k *InlineKeyboardBuilder) Row() *InlineKeyboardBuilder {
+	if len(k.rows[len(k.rows)-1]) > 0 {
+		k.rows = append(k.rows, []InlineKeyboardButton{})
+	}
+	return k
+}
+
+// Button appends given button.
+func (k *InlineKeyboardBuilder) Button(button InlineKeyboardButton) *InlineKeyboardBuilder {
+	if err := checkInlineKeyboardButton(button); err != nil {
+		k.fail(err)
+		return k
+	}
+
+	if k.columns > 0 && len(k.rows[len(k.rows)-1]) >= k.columns {
+		k.Row()
+	}
+	k.rows[len(k.rows)-1] = append(k.rows[len(k.rows)-1], button)
+
+	return k
+}
+
+// URL appends a button which opens given url.
+func (k *InlineKeyboardBuilder) URL(text, url string) *InlineKeyboardBuilder {
+	return k.Button(InlineKeyboardButton{Text: text, URL: &url})
+}
+
+// LoginURL appends a button which authorizes the user with given login url.
+func (k *InlineKeyboardBuilder) LoginURL(text string, loginURL LoginURL) *InlineKeyboardBuilder {
+	return k.Button(InlineKeyboardButton{Text: text, LoginURL: &loginURL})
+}
+
+// Callback appends a button with given callback data. (1-64 bytes)
+func (k *InlineKeyboardBuilder) Callback(text, data string) *InlineKeyboardBuilder {
+	return k.Button(InlineKeyboardButton{Text: text, CallbackData: &data})
+}
+
+// EncodedCallback appends a button with callback data encoded by given codec.
+func (k *InlineKeyboardBuilder) EncodedCallback(codec *CallbackCodec, text, kind string, payload interface{}) *InlineKeyboardBuilder {
+	button, err := codec.InlineKeyboardButton(text, kind, payload)
+	if err != nil {
+		k.fail(err)
+		return k
+	}
+	return k.Button(button)
+}
+
+// SwitchInlineQuery appends a button which lets the user choose a chat and inserts given query.
+func (k *InlineKeyboardBuilder) SwitchInlineQuery(text, query string) *InlineKeyboardBuilder {
+	return k.Button(InlineKeyboardButton{Text: text, SwitchInlineQuery: &query})
+}
+
+// SwitchInlineQueryCurrentChat appends a button which inserts given query in the current chat.
+func (k *InlineKeyboardBuilder) SwitchInlineQueryCurrentChat(text, query string) *InlineKeyboardBuilder {
+	return k.Button(InlineKeyboardButton{Text: text, SwitchInlineQueryCurrentChat: &query})
+}
+
+// Game appends a button which launches the game. (should be the first button in the first row)
+func (k *InlineKeyboardBuilder) Game(text string) *InlineKeyboardBuilder {
+	return k.Button(InlineKeyboardButton{Text: text, CallbackGame: &CallbackGame{}})
+}
+
+// Pay appends a pay button. (should be the first button in the first row)
+func (k *InlineKeyboardBuilder) Pay(text string) *InlineKeyboardBuilder {
+	return k.Button(InlineKeyboardButton{Text: text, Pay: true})
+}
+
+// Build returns the built InlineKeyboardMarkup, or the first error occurred while building.
+func (k *InlineKeyboardBuilder) Build() (InlineKeyboardMarkup, error) {
+	if k.err != nil {
+		return InlineKeyboardMarkup{}, k.err
+	}
+
+	rows := [][]InlineKeyboardButton{}
+	for _, row := range k.rows {
+		if len(row) > 0 {
+			rows = append(rows, row)
+		}
+	}
+
+	// game and pay buttons should be the first button in the first row
+	for i, row := range rows {
+		for j, button := range row {
+			if (button.CallbackGame != nil || button.Pay) && (i != 0 || j != 0) {
+				return InlineKeyboardMarkup{}, fmt.Errorf("game or pay button should be the first button in the first row: '%s'", button.Text)
+			}
+		}
+	}
+
+	return InlineKeyboardMarkup{InlineKeyboard: rows}, nil
+}
+
+// Keep the first error.
+func (k *InlineKeyboardBuilder) fail(err error) {
+	if k.err == nil {
+		k.err = err
+	}
+}
+
+// Check if given inline keyboard button is valid.
+func checkInlineKeyboardButton(button InlineKeyboardButton) error {
+	if button.Text == "" {
+		return fmt.Errorf("text of inline keyboard button is empty")
+	}
+
+	fields := 0
+	if button.URL != nil {
+		if *button.URL == "" {
+			return fmt.Errorf("url of inline keyboard button '%s' is empty", button.Text)
+		}
+		fields++
+	}
+	if button.LoginURL != nil {
+		if button.LoginURL.URL == "" {
+			return fmt.Errorf("login url of inline keyboard button '%s' is empty", button.Text)
+		}
+		fields++
+	}
+	if button.CallbackData != nil {
+		if len(*button.CallbackData) == 0 || len(*button.CallbackData) > maxCallbackDataBytes {
+			return fmt.Errorf("callback data of inline keyboard button '%s' should be 1-%d bytes: %d bytes", button.Text, maxCallbackDataBytes, len(*button.CallbackData))
+		}
+		fields++
+	}
+	if button.SwitchInlineQuery != nil {
+		fields++
+	}
+	if button.SwitchInlineQueryCurrentChat != nil {
+		fields++
+	}
+	if button.CallbackGame != nil {
+		fields++
+	}
+	if button.Pay {
+		fields++
+	}
+
+	if fields != 1 {
+		return fmt.Errorf("inline keyboard button '%s' should have exactly one optional field: %d fields", button.Text, fields)
+	}
+
+	return nil
+}
+
+////////////////////////////////
+// Reply keyboard
+//
+
+// ReplyKeyboardBuilder is a builder for ReplyKeyboardMarkup
+type ReplyKeyboardBuilder struct {
+	rows    [][]KeyboardButton
+	columns int
+	err     error
+
+	resize, oneTime, selective bool
+}
+
+// NewReplyKeyboardBuilder generates a new ReplyKeyboardBuilder.
+func NewReplyKeyboardBuilder() *ReplyKeyboardBuilder {
+	return &ReplyKeyboardBuilder{
+		rows: [][]KeyboardButton{{}},
+	}
+}
+
+// Columns sets the number of columns: following buttons are wrapped into a new row automatically
+// when the current row has given number of buttons. (0 for no wrapping)
+func (k *ReplyKeyboardBuilder) Columns(columns int) *ReplyKeyboardBuilder {
+	if columns < 0 {
+		columns = 0
+	}
+	k.columns = columns
+	return k
+}
+
+// Row starts a new row.
+func (k *ReplyKeyboardBuilder) Row() *ReplyKeyboardBuilder {
+	if len(k.rows[len(k.rows)-1]) > 0 {
+		k.rows = append(k.rows, []KeyboardButton{})
+	}
+	return k
+}
+
+// Button appends given button.
+func (k *ReplyKeyboardBuilder) Button(button KeyboardButton) *ReplyKeyboardBuilder {
+	if button.Text == "" {
+		k.fail(fmt.Errorf("text of keyboard button is empty"))
+		return k
+	}
+	if button.RequestContact && button.RequestLocation {
+		k.fail(fmt.Errorf("keyboard button '%s' cannot request both contact and location", button.Text))
+		return k
+	}
+
+	if k.columns > 0 && len(k.rows[len(k.rows)-1]) >= k.columns {
+		k.Row()
+	}
+	k.rows[len(k.rows)-1] = append(k.rows[len(k.rows)-1], button)
+
+	return k
+}
+
+// Text appends buttons with given texts.
+func (k *ReplyKeyboardBuilder) Text(texts ...string) *ReplyKeyboardBuilder {
+	for _, text := range texts {
+		k.Button(KeyboardButton{Text: text})
+	}
+	return k
+}
+
+// RequestContact appends a button which sends the user's phone number.
+func (k *ReplyKeyboardBuilder) RequestContact(text string) *ReplyKeyboardBuilder {
+	return k.Button(KeyboardButton{Text: text, RequestContact: true})
+}
+
+// RequestLocation appends a button which sends the user's current location.
+func (k *ReplyKeyboardBuilder) RequestLocation(text string) *ReplyKeyboardBuilder {
+	return k.Button(KeyboardButton{Text: text, RequestLocation: true})
+}
+
+// Resize makes clients resize the keyboard vertically.
+func (k *ReplyKeyboardBuilder) Resize() *ReplyKeyboardBuilder {
+	k.resize = true
+	return k
+}
+
+// OneTime makes clients hide the keyboard after it is used.
+func (k *ReplyKeyboardBuilder) OneTime() *ReplyKeyboardBuilder {
+	k.oneTime = true
+	return k
+}
+
+// Selective makes the keyboard shown only to specific users. (mentioned, or replied)
+func (k *ReplyKeyboardBuilder) Selective() *ReplyKeyboardBuilder {
+	k.selective = true
+	return k
+}
+
+// Build returns the built ReplyKeyboardMarkup, or the first error occurred while building.
+func (k *ReplyKeyboardBuilder) Build() (ReplyKeyboardMarkup, error) {
+	if k.err != nil {
+		return ReplyKeyboardMarkup{}, k.err
+	}
+
+	rows := [][]KeyboardButton{}
+	for _, row := range k.rows {
+		if len(row) > 0 {
+			rows = append(rows, row)
+		}
+	}
+	if len(rows) == 0 {
+		return ReplyKeyboardMarkup{}, fmt.Errorf("reply keyboard has no buttons")
+	}
+
+	return ReplyKeyboardMarkup{
+		Keyboard:        rows,
+		ResizeKeyboard:  k.resize,
+		OneTimeKeyboard: k.oneTime,
+		Selective:       k.selective,
+	}, nil
+}
+
+// Keep the first error.
+func (k *ReplyKeyboardBuilder) fail(err error) {
+	if k.err == nil {
+		k.err = err
+	}
+}
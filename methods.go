@@ -32,27 +32,21 @@ func (b *Bot) GetUpdates(options OptionsGetUpdates) (result APIResponseUpdates)
 // port should be one of: 443, 80, 88, or 8443.
 // default maxConnections = 40
 //
+// certFilepath can be empty when the certificate is not a self-signed one.
+//
 // https://core.telegram.org/bots/api#setwebhook
 func (b *Bot) SetWebhookWithOptions(host string, port int, certFilepath string, maxConnections int, allowedUpdates []UpdateType) (result APIResponseBool) {
 	b.webhookHost = host
 	b.webhookPort = port
-	b.webhookURL = b.getWebhookURL()
 
-	file, err := os.Open(certFilepath)
-	if err != nil {
-		panic(err)
+	options := OptionsSetWebhook{}.
+		SetMaxConnections(maxConnections).
+		SetAllowedUpdates(allowedUpdates)
+	if certFilepath != "" {
+		options.SetCertificate(certFilepath)
 	}
 
-	params := map[string]interface{}{
-		"url":             b.webhookURL,
-		"certificate":     file,
-		"max_connections": maxConnections,
-		"allowed_updates": allowedUpdates,
-	}
-
-	b.verbose("setting webhook url to: %s", b.webhookURL)
-
-	return b.requestResponseBool("setWebhook", params)
+	return b.setWebhook(b.getWebhookURL(), options)
 }
 
 // SetWebhook sets webhook url and certificate for receiving incoming updates.
@@ -60,18 +54,100 @@ func (b *Bot) SetWebhook(host string, port int, certFilepath string) (result API
 	return b.SetWebhookWithOptions(host, port, certFilepath, 40, []UpdateType{})
 }
 
+// SetWebhookWithURL sets given public url as the webhook url for receiving incoming updates.
+//
+// Useful when the webhook server is behind a load balancer or a TLS-terminating proxy,
+// so the public url differs from the one which the server listens on.
+// The path of given url will be used as the path of webhook. (see WebhookPath())
+//
+// https://core.telegram.org/bots/api#setwebhook
+func (b *Bot) SetWebhookWithURL(webhookURL string, options OptionsSetWebhook) (result APIResponseBool) {
+	parsed, err := url.Parse(webhookURL)
+	if err != nil || parsed.Scheme != "https" || parsed.Host == "" {
+		errStr := fmt.Sprintf("invalid webhook url: %s", webhookURL)
+
+		b.error(errStr)
+
+		return APIResponseBool{APIResponseBase: APIResponseBase{Ok: false, Description: &errStr}}
+	}
+
+	b.webhookHost = parsed.Hostname()
+	if parsed.Path != "" && parsed.Path != "/" {
+		b.SetWebhookPath(parsed.Path)
+	}
+
+	return b.setWebhook(webhookURL, options)
+}
+
 // DeleteWebhook deletes webhook for this bot.
 // (Function GetUpdates will not work if webhook is set, so in that case you'll need to delete it)
 //
 // https://core.telegram.org/bots/api#deletewebhook
-func (b *Bot) DeleteWebhook() (result APIResponseBool) {
+func (b *Bot) DeleteWebhook(options OptionsDeleteWebhook) (result APIResponseBool) {
+	if options == nil {
+		options = map[string]interface{}{}
+	}
+
 	b.webhookHost = ""
 	b.webhookPort = 0
-	b.webhookURL = ""
+	b.setRegisteredWebhook("", nil)
 
 	b.verbose("deleting webhook url")
 
-	return b.requestResponseBool("deleteWebhook", map[string]interface{}{})
+	return b.requestResponseBool("deleteWebhook", options)
+}
+
+// WebhookPath returns the path of webhook url.
+//
+// Handler from WebhookHandler() should be mounted on this path.
+func (b *Bot) WebhookPath() string {
+	return b.getWebhookPath()
+}
+
+// Set webhook url with given options.
+func (b *Bot) setWebhook(webhookURL string, options OptionsSetWebhook) (result APIResponseBool) {
+	if options == nil {
+		options = map[string]interface{}{}
+	}
+
+	// check certificate file before uploading it
+	var certificate *InputFile
+	if cert, ok := options["certificate"].(InputFile); ok {
+		certificate = &cert
+	}
+	if certificate != nil && certificate.Filepath != nil {
+		if _, err := os.Stat(*certificate.Filepath); err != nil {
+			errStr := fmt.Sprintf("failed to read certificate file: %s", err)
+
+			b.error(errStr)
+
+			return APIResponseBool{APIResponseBase: APIResponseBase{Ok: false, Description: &errStr}}
+		}
+	}
+
+	// secret token for authenticating webhook requests
+	if token, ok := options["secret_token"].(string); ok {
+		if err := checkSecretToken(token); err != nil {
+			errStr := err.Error()
+
+			b.error(errStr)
+
+			return APIResponseBool{APIResponseBase: APIResponseBase{Ok: false, Description: &errStr}}
+		}
+
+		b.setWebhookSecretToken(token)
+	} else if current := b.getWebhookAuth().secretToken; current != "" {
+		options["secret_token"] = current
+	}
+
+	// essential params
+	options["url"] = webhookURL
+
+	b.setRegisteredWebhook(webhookURL, certificate)
+
+	b.verbose("setting webhook url to: %s", webhookURL)
+
+	return b.requestResponseBool("setWebhook", options)
 }
 
 // GetWebhookInfo gets webhook info for this bot.
@@ -328,17 +404,33 @@ func (b *Bot) SendVideoNote(chatID ChatID, videoNote InputFile, options OptionsS
 
 // SendMediaGroup sends a group of photos or videos as an album.
 //
+// New files in media are uploaded with 'attach://<name>',
+// and more than 10 media are split and sent as several albums. (returned messages are concatenated)
+//
 // https://core.telegram.org/bots/api#sendmediagroup
 func (b *Bot) SendMediaGroup(chatID ChatID, media []InputMedia, options OptionsSendMediaGroup) (result APIResponseMessages) {
-	if options == nil {
-		options = map[string]interface{}{}
-	}
+	// more than 10 media are sent in several groups
+	for _, chunk := range chunkMediaGroup(media) {
+		params := map[string]interface{}{}
+		for k, v := range options {
+			params[k] = v
+		}
 
-	// essential params
-	options["chat_id"] = chatID
-	options["media"] = media
+		// essential params
+		params["chat_id"] = chatID
+		params["media"] = attachInputMedia(chunk, params)
+
+		sent := b.requestResponseMessages("sendMediaGroup", params)
+		if !sent.Ok {
+			sent.Result = append(result.Result, sent.Result...) // keep messages which were already sent
+			return sent
+		}
 
-	return b.requestResponseMessages("sendMediaGroup", options)
+		result.APIResponseBase = sent.APIResponseBase
+		result.Result = append(result.Result, sent.Result...)
+	}
+
+	return result
 }
 
 // SendLocation sends locations.
@@ -780,6 +872,8 @@ func (b *Bot) EditMessageCaption(caption string, options OptionsEditMessageCapti
 
 // EditMessageMedia edites a media message
 //
+// New files in media are uploaded with 'attach://<name>'.
+//
 // https://core.telegram.org/bots/api#editmessagemedia
 func (b *Bot) EditMessageMedia(media InputMedia, options OptionsEditMessageMedia) (result APIResponseMessageOrBool) {
 	if options == nil {
@@ -787,7 +881,7 @@ func (b *Bot) EditMessageMedia(media InputMedia, options OptionsEditMessageMedia
 	}
 
 	// essential params
-	options["media"] = media
+	options["media"] = attachInputMedia([]InputMedia{media}, options)[0]
 
 	return b.requestResponseMessageOrBool("editMessageMedia", options)
 }
@@ -992,6 +1086,17 @@ func checkIfFileParamExists(params map[string]interface{}) bool {
 	return false
 }
 
+// Check if given http params contain *os.File or not.
+func checkIfOSFileParamExists(params map[string]interface{}) bool {
+	for _, value := range params {
+		if _, ok := value.(*os.File); ok {
+			return true
+		}
+	}
+
+	return false
+}
+
 // Convert given interface to string. (for HTTP params)
 func (b *Bot) paramToString(param interface{}) (result string, success bool) {
 	switch param.(type) {
@@ -1053,8 +1158,35 @@ func (b *Bot) paramToString(param interface{}) (result string, success bool) {
 
 // Send request to API server and return the response as bytes(synchronously).
 //
+// Requests to migrated chats are sent to their new chat ids,
+// and a request which fails due to chat migration is retried once with the new chat id.
+//
 // NOTE: If *os.File is included in the params, it will be closed automatically by this function.
 func (b *Bot) request(method string, params map[string]interface{}) (resp []byte, err error) {
+	params = b.replaceMigratedChatIDs(params)
+
+	if resp, err = b.send(method, params); err == nil {
+		if to, migrated := migrationInResponse(resp); migrated {
+			// the migrated chat is unambiguous only when there is exactly one chat param
+			if key, ok := singleChatParamKey(params); !ok {
+				b.error("%s failed due to chat migration (=> %d), but the migrated chat is ambiguous", method, to)
+			} else if from, ok := chatIDToInt64(params[key]); ok && from != to {
+				b.migrateChat(from, to)
+
+				if !checkIfOSFileParamExists(params) { // (*os.File is already closed)
+					b.verbose("retrying %s with migrated chat id: %d => %d", method, from, to)
+
+					return b.send(method, b.replaceMigratedChatIDs(params))
+				}
+			}
+		}
+	}
+
+	return resp, err
+}
+
+// Send request to API server.
+func (b *Bot) send(method string, params map[string]interface{}) (resp []byte, err error) {
 	apiURL := fmt.Sprintf("%s%s/%s", apiBaseURL, b.token, method)
 
 	b.verbose("sending request to api url: %s, params: %#v", apiURL, params)
@@ -1621,26 +1753,84 @@ func (b *Bot) requestResponsePoll(method string, params map[string]interface{})
 	return APIResponsePoll{APIResponseBase: APIResponseBase{Ok: false, Description: &errStr}}
 }
 
-// Handle Webhook request.
-func (b *Bot) handleWebhook(writer http.ResponseWriter, req *http.Request) {
+// Send request and fetch its result as APIResponseBase. (result is ignored)
+func (b *Bot) requestResponseBase(method string, params map[string]interface{}) (result APIResponseBase) {
+	var errStr string
+
+	if bytes, err := b.request(method, params); err == nil {
+		var jsonResponse APIResponseBase
+		err = json.Unmarshal(bytes, &jsonResponse)
+		if err == nil {
+			return jsonResponse
+		}
+
+		errStr = fmt.Sprintf("json parse error: %s (%s)", err, string(bytes))
+	} else {
+		errStr = fmt.Sprintf("%s failed with error: %s", method, err)
+	}
+
+	b.error(errStr)
+
+	return APIResponseBase{Ok: false, Description: &errStr}
+}
+
+// Authorize and parse a webhook request, then pass it to given dispatch function.
+//
+// If the dispatch function returns a reply, it will be written in the response.
+func (b *Bot) serveWebhook(writer http.ResponseWriter, req *http.Request, dispatch func(webhook Update, err error) *WebhookReply) {
 	defer req.Body.Close()
 
 	b.verbose("received webhook request: %+v", req)
 
-	if body, err := ioutil.ReadAll(req.Body); err == nil {
+	if statusCode, err := b.authorizeWebhook(req); err != nil {
+		b.error("unauthorized webhook request (%s)", err)
+
+		http.Error(writer, http.StatusText(statusCode), statusCode)
+		return
+	}
+
+	if req.Method != http.MethodPost {
+		b.error("webhook request with unsupported method: %s", req.Method)
+
+		writer.Header().Set("Allow", http.MethodPost)
+		http.Error(writer, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+		return
+	}
+
+	if body, err := readWebhookBody(req); err == nil {
 		var webhook Update
 		if err = json.Unmarshal(body, &webhook); err != nil {
 			b.error("error while parsing json (%s)", err)
+
+			http.Error(writer, http.StatusText(http.StatusBadRequest), http.StatusBadRequest)
 		} else {
 			b.verbose("received webhook body: %s", string(body))
 
-			b.updateHandler(b, webhook, nil)
+			b.writeWebhookReply(writer, dispatch(webhook, nil))
 		}
 	} else {
 		b.error("error while reading webhook request (%s)", err)
 
-		b.updateHandler(b, Update{}, err)
+		dispatch(Update{}, err)
+
+		statusCode := http.StatusBadRequest
+		if err == errWebhookBodyTooLarge {
+			statusCode = http.StatusRequestEntityTooLarge
+		}
+		http.Error(writer, http.StatusText(statusCode), statusCode)
+	}
+}
+
+// Read the body of a webhook request. (returns errWebhookBodyTooLarge if it exceeds maxWebhookBodyBytes)
+func readWebhookBody(req *http.Request) ([]byte, error) {
+	body, err := ioutil.ReadAll(io.LimitReader(req.Body, maxWebhookBodyBytes+1))
+	if err != nil {
+		return nil, err
+	}
+	if len(body) > maxWebhookBodyBytes {
+		return nil, errWebhookBodyTooLarge
 	}
+	return body, nil
 }
 
 // get file extension from bytes array
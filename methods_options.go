@@ -36,6 +36,66 @@ func (o OptionsGetUpdates) SetAllowedUpdates(allowedUpdates []AllowedUpdate) Opt
 	return o
 }
 
+// OptionsSetWebhook struct for SetWebhookWithURL().
+//
+// options include: certificate, ip_address, max_connections, allowed_updates, drop_pending_updates, and secret_token.
+//
+// https://core.telegram.org/bots/api#setwebhook
+type OptionsSetWebhook MethodOptions
+
+// SetCertificate sets the certificate value of OptionsSetWebhook.
+//
+// Only needed for self-signed certificates.
+func (o OptionsSetWebhook) SetCertificate(certFilepath string) OptionsSetWebhook {
+	o["certificate"] = InputFileFromFilepath(certFilepath)
+	return o
+}
+
+// SetIPAddress sets the ip_address value of OptionsSetWebhook.
+func (o OptionsSetWebhook) SetIPAddress(ipAddress string) OptionsSetWebhook {
+	o["ip_address"] = ipAddress
+	return o
+}
+
+// SetMaxConnections sets the max_connections value of OptionsSetWebhook.
+func (o OptionsSetWebhook) SetMaxConnections(maxConnections int) OptionsSetWebhook {
+	o["max_connections"] = maxConnections
+	return o
+}
+
+// SetAllowedUpdates sets the allowed_updates value of OptionsSetWebhook.
+func (o OptionsSetWebhook) SetAllowedUpdates(allowedUpdates []UpdateType) OptionsSetWebhook {
+	o["allowed_updates"] = allowedUpdates
+	return o
+}
+
+// SetDropPendingUpdates sets the drop_pending_updates value of OptionsSetWebhook.
+func (o OptionsSetWebhook) SetDropPendingUpdates(drop bool) OptionsSetWebhook {
+	o["drop_pending_updates"] = drop
+	return o
+}
+
+// SetSecretToken sets the secret_token value of OptionsSetWebhook.
+//
+// It will also be used for authenticating incoming webhook requests.
+func (o OptionsSetWebhook) SetSecretToken(secretToken string) OptionsSetWebhook {
+	o["secret_token"] = secretToken
+	return o
+}
+
+// OptionsDeleteWebhook struct for DeleteWebhook().
+//
+// options include: drop_pending_updates.
+//
+// https://core.telegram.org/bots/api#deletewebhook
+type OptionsDeleteWebhook MethodOptions
+
+// SetDropPendingUpdates sets the drop_pending_updates value of OptionsDeleteWebhook.
+func (o OptionsDeleteWebhook) SetDropPendingUpdates(drop bool) OptionsDeleteWebhook {
+	o["drop_pending_updates"] = drop
+	return o
+}
+
 // OptionsSendMessage struct for SendMessage().
 //
 // options include: parse_mode, disable_web_page_preview, disable_notification, reply_to_message_id, and reply_markup.
@@ -804,6 +864,18 @@ func (o OptionsPinChatMessage) SetDisableNotification(disable bool) OptionsPinCh
 // https://core.telegram.org/bots/api#answercallbackquery
 type OptionsAnswerCallbackQuery MethodOptions
 
+// SetText sets the text value of OptionsAnswerCallbackQuery.
+func (o OptionsAnswerCallbackQuery) SetText(text string) OptionsAnswerCallbackQuery {
+	o["text"] = text
+	return o
+}
+
+// SetShowAlert sets the show_alert value of OptionsAnswerCallbackQuery.
+func (o OptionsAnswerCallbackQuery) SetShowAlert(showAlert bool) OptionsAnswerCallbackQuery {
+	o["show_alert"] = showAlert
+	return o
+}
+
 // SetURL sets the url value of OptionsAnswerCallbackQuery.
 func (o OptionsAnswerCallbackQuery) SetURL(url string) OptionsAnswerCallbackQuery {
 	o["url"] = url
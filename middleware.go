@@ -0,0 +1,254 @@
+package telegrambot
+
+// Composing update handlers with middleware
+
+import (
+	"fmt"
+	"runtime/debug"
+	"sync"
+	"time"
+)
+
+// context keys for values which are set by built-in middleware
+const (
+	ContextKeyElapsed = "elapsed" // time.Duration, set by TimingMiddleware
+)
+
+// UpdateContext is a per-update context which is passed through middleware and handlers
+type UpdateContext struct {
+	Bot    *Bot
+	Update Update
+	Err    error // error from polling or webhook
+
+	sync.RWMutex
+	values map[string]interface{}
+}
+
+// NewUpdateContext generates a new UpdateContext.
+func NewUpdateContext(b *Bot, update Update, err error) *UpdateContext {
+	return &UpdateContext{
+		Bot:    b,
+		Update: update,
+		Err:    err,
+		values: map[string]interface{}{},
+	}
+}
+
+// Set sets a value for given key.
+func (c *UpdateContext) Set(key string, value interface{}) {
+	c.Lock()
+	defer c.Unlock()
+
+	c.values[key] = value
+}
+
+// Get returns the value for given key.
+func (c *UpdateContext) Get(key string) (value interface{}, exists bool) {
+	c.RLock()
+	defer c.RUnlock()
+
+	value, exists = c.values[key]
+	return value, exists
+}
+
+// GetString returns the string value for given key. (empty if not exists or not a string)
+func (c *UpdateContext) GetString(key string) string {
+	if value, exists := c.Get(key); exists {
+		if str, ok := value.(string); ok {
+			return str
+		}
+	}
+	return ""
+}
+
+// Handler is an interface of update handlers
+type Handler interface {
+	HandleUpdate(ctx *UpdateContext)
+}
+
+// HandlerFunc is a function type which implements Handler
+type HandlerFunc func(ctx *UpdateContext)
+
+// HandleUpdate calls the function itself.
+func (f HandlerFunc) HandleUpdate(ctx *UpdateContext) {
+	f(ctx)
+}
+
+// HandlerFromFunc converts an update handler function into Handler.
+//
+// (eg. `HandlerFromFunc(router.Handle)`)
+func HandlerFromFunc(handler func(b *Bot, update Update, err error)) Handler {
+	return HandlerFunc(func(ctx *UpdateContext) {
+		handler(ctx.Bot, ctx.Update, ctx.Err)
+	})
+}
+
+// Middleware wraps a Handler.
+//
+// It can do things before and after calling the next handler, or skip it for short-circuiting.
+type Middleware func(next Handler) Handler
+
+// Pipeline is a chain of middleware which ends with a handler
+type Pipeline struct {
+	sync.RWMutex
+
+	middlewares []Middleware
+	handler     Handler
+	composed    Handler
+}
+
+// NewPipeline generates a new Pipeline which ends with given handler.
+func NewPipeline(handler Handler) *Pipeline {
+	return &Pipeline{
+		handler: handler,
+	}
+}
+
+// Use appends given middleware to the pipeline.
+//
+// Middleware are called in the order of addition.
+func (p *Pipeline) Use(middlewares ...Middleware) *Pipeline {
+	p.Lock()
+	defer p.Unlock()
+
+	p.middlewares = append(p.middlewares, middlewares...)
+	p.composed = nil
+
+	return p
+}
+
+// HandleUpdate passes given context through the middleware and the handler.
+func (p *Pipeline) HandleUpdate(ctx *UpdateContext) {
+	p.compose().HandleUpdate(ctx)
+}
+
+// Handle passes given update through the middleware and the handler.
+//
+// It can be used as an update handler function. (eg. `bot.StartMonitoringUpdates(0, 1, pipeline.Handle)`)
+func (p *Pipeline) Handle(b *Bot, update Update, err error) {
+	p.HandleUpdate(NewUpdateContext(b, update, err))
+}
+
+// Compose middleware and handler into one. (cached until middleware change)
+func (p *Pipeline) compose() Handler {
+	p.RLock()
+	composed := p.composed
+	p.RUnlock()
+
+	if composed != nil {
+		return composed
+	}
+
+	p.Lock()
+	defer p.Unlock()
+
+	composed = p.handler
+	if composed == nil {
+		composed = HandlerFunc(func(ctx *UpdateContext) {})
+	}
+	for i := len(p.middlewares) - 1; i >= 0; i-- {
+		composed = p.middlewares[i](composed)
+	}
+	p.composed = composed
+
+	return composed
+}
+
+// HandleUpdate routes the update in given context. (implements Handler)
+func (r *CommandRouter) HandleUpdate(ctx *UpdateContext) {
+	r.Handle(ctx.Bot, ctx.Update, ctx.Err)
+}
+
+// HandleUpdate routes the update in given context. (implements Handler)
+func (r *CallbackRouter) HandleUpdate(ctx *UpdateContext) {
+	r.Handle(ctx.Bot, ctx.Update, ctx.Err)
+}
+
+////////////////////////////////
+// Built-in middleware
+//
+
+// LoggingMiddleware logs updates and errors.
+//
+// Updates are logged only when Bot.Verbose == true.
+func LoggingMiddleware() Middleware {
+	return func(next Handler) Handler {
+		return HandlerFunc(func(ctx *UpdateContext) {
+			if ctx.Err != nil {
+				ctx.Bot.error("error while receiving update: %s", ctx.Err)
+			} else {
+				ctx.Bot.verbose("received update: %s", ctx.Update)
+			}
+
+			next.HandleUpdate(ctx)
+		})
+	}
+}
+
+// RecoveryMiddleware recovers from panics in the next handlers.
+//
+// If onPanic is nil, the panic and its stack trace will be logged.
+func RecoveryMiddleware(onPanic func(ctx *UpdateContext, recovered interface{})) Middleware {
+	return func(next Handler) Handler {
+		return HandlerFunc(func(ctx *UpdateContext) {
+			defer func() {
+				if recovered := recover(); recovered != nil {
+					if onPanic != nil {
+						onPanic(ctx, recovered)
+					} else {
+						ctx.Bot.error("recovered from panic while handling update #%d: %s\n%s", ctx.Update.UpdateID, fmt.Sprint(recovered), debug.Stack())
+					}
+				}
+			}()
+
+			next.HandleUpdate(ctx)
+		})
+	}
+}
+
+// TimingMiddleware measures the elapsed time of the next handlers.
+//
+// The elapsed time is set to the context with key: ContextKeyElapsed.
+// If onTimed is nil, it will be logged only when Bot.Verbose == true.
+func TimingMiddleware(onTimed func(ctx *UpdateContext, elapsed time.Duration)) Middleware {
+	return func(next Handler) Handler {
+		return HandlerFunc(func(ctx *UpdateContext) {
+			started := time.Now()
+			defer func() {
+				elapsed := time.Since(started)
+				ctx.Set(ContextKeyElapsed, elapsed)
+
+				if onTimed != nil {
+					onTimed(ctx, elapsed)
+				} else {
+					ctx.Bot.verbose("handled update #%d in %s", ctx.Update.UpdateID, elapsed)
+				}
+			}()
+
+			next.HandleUpdate(ctx)
+		})
+	}
+}
+
+// ChatTypeMiddleware passes only the updates from chats of given types.
+//
+// Updates without chats (eg. inline queries) and errors are not passed.
+func ChatTypeMiddleware(chatTypes ...ChatType) Middleware {
+	allowed := map[ChatType]bool{}
+	for _, chatType := range chatTypes {
+		allowed[chatType] = true
+	}
+
+	return func(next Handler) Handler {
+		return HandlerFunc(func(ctx *UpdateContext) {
+			if ctx.Err == nil {
+				if chat := ctx.Update.GetChat(); chat != nil && allowed[chat.Type] {
+					next.HandleUpdate(ctx)
+					return
+				}
+			}
+
+			ctx.Bot.verbose("skipping update #%d not from chat types: %v", ctx.Update.UpdateID, chatTypes)
+		})
+	}
+}
@@ -0,0 +1,521 @@
+package telegrambot
+
+// Payments workflow: orders with invoices, shipping queries, pre-checkout queries, and successful payments
+//
+// https://core.telegram.org/bots/payments
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+)
+
+const (
+	orderKeyPrefix     = "order:"
+	orderPayloadPrefix = "order:"
+
+	defaultPaymentHookTimeoutSeconds = 7 // shipping and pre-checkout queries should be answered in 10 seconds
+	defaultPaymentErrorMessage       = "Sorry, your order could not be processed. Please try again later."
+
+	maxOrderUpdateRetries = 5
+)
+
+// OrderStatus is a status of an order
+type OrderStatus string
+
+// OrderStatus strings
+const (
+	OrderStatusPending   OrderStatus = "pending"   // invoice was sent
+	OrderStatusApproved  OrderStatus = "approved"  // pre-checkout query was answered with ok
+	OrderStatusPaid      OrderStatus = "paid"      // successful payment was received
+	OrderStatusCancelled OrderStatus = "cancelled" // cancelled before payment
+)
+
+// Order is a stored state of an order which is paid with an invoice
+type Order struct {
+	ID          string            `json:"id"`
+	ChatID      int64             `json:"chat_id"`
+	UserID      int               `json:"user_id,omitempty"` // only this user can pay, if set
+	Title       string            `json:"title"`
+	Description string            `json:"description"`
+	Currency    string            `json:"currency"`
+	Prices      []LabeledPrice    `json:"prices"`
+	Data        map[string]string `json:"data,omitempty"` // application data (eg. product ids)
+
+	Status           OrderStatus        `json:"status"`
+	InvoiceMessageID int                `json:"invoice_message_id,omitempty"`
+	ShippingOptions  []ShippingOption   `json:"shipping_options,omitempty"` // offered for shipping query
+	ShippingOptionID string             `json:"shipping_option_id,omitempty"`
+	OrderInfo        *OrderInfo         `json:"order_info,omitempty"`
+	Payment          *SuccessfulPayment `json:"payment,omitempty"`
+
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+	PaidAt    time.Time `json:"paid_at,omitempty"`
+}
+
+// TotalAmount returns the total amount of the order's prices. (without shipping)
+func (o Order) TotalAmount() int {
+	total := 0
+	for _, price := range o.Prices {
+		total += price.Amount
+	}
+	return total
+}
+
+// ShippingAmount returns the total amount of the shipping option with given id.
+func (o Order) ShippingAmount(shippingOptionID string) (amount int, exists bool) {
+	for _, option := range o.ShippingOptions {
+		if option.ID == shippingOptionID {
+			for _, price := range option.Prices {
+				amount += price.Amount
+			}
+			return amount, true
+		}
+	}
+	return 0, false
+}
+
+// InvoicePayload returns the invoice payload of the order.
+func (o Order) InvoicePayload() string {
+	return orderPayloadPrefix + o.ID
+}
+
+// PaymentsConfig is a struct of configurations for OrderManager
+type PaymentsConfig struct {
+	ProviderToken string
+
+	HookTimeoutSeconds int    // timeout of hooks for shipping and pre-checkout queries (default: 7)
+	ErrorMessage       string // error message for internal errors and timeouts
+
+	// returns shipping options for given address (error message is shown to the user)
+	ShippingOptions func(b *Bot, order Order, address ShippingAddress) ([]ShippingOption, error)
+
+	// validates the order before checkout, eg. checking stocks (error message is shown to the user)
+	ValidateOrder func(b *Bot, order Order, query PreCheckoutQuery) error
+
+	// called once for each paid order
+	OnPaid func(b *Bot, order Order)
+}
+
+// OrderManager sends invoices for orders, and handles their payment updates
+type OrderManager struct {
+	b       *Bot
+	storage Storage
+	config  PaymentsConfig
+}
+
+// NewOrderManager generates a new OrderManager with given storage and configurations.
+func (b *Bot) NewOrderManager(storage Storage, config PaymentsConfig) *OrderManager {
+	if config.HookTimeoutSeconds <= 0 {
+		config.HookTimeoutSeconds = defaultPaymentHookTimeoutSeconds
+	}
+	if config.ErrorMessage == "" {
+		config.ErrorMessage = defaultPaymentErrorMessage
+	}
+
+	return &OrderManager{
+		b:       b,
+		storage: storage,
+		config:  config,
+	}
+}
+
+// SendInvoice records given order as a new pending one, and sends its invoice to the order's chat.
+//
+// ID, status, and timestamps of the order are generated.
+func (m *OrderManager) SendInvoice(order Order, startParameter string, options OptionsSendInvoice) (Order, error) {
+	id, err := newUUID()
+	if err != nil {
+		return order, fmt.Errorf("failed to generate order id: %w", err)
+	}
+
+	now := time.Now()
+	order.ID = id
+	order.Status = OrderStatusPending
+	order.CreatedAt, order.UpdatedAt = now, now
+
+	if err = m.save(order, 0); err != nil {
+		return order, err
+	}
+
+	sent := m.b.SendInvoice(order.ChatID, order.Title, order.Description, order.InvoicePayload(), m.config.ProviderToken, startParameter, order.Currency, order.Prices, options)
+	if !sent.Ok || sent.Result == nil {
+		if err := m.storage.Delete(orderKeyPrefix + order.ID); err != nil {
+			m.b.error("failed to delete pending order %s: %s", order.ID, err)
+		}
+
+		return order, fmt.Errorf("failed to send invoice: %s", descriptionOf(sent.APIResponseBase))
+	}
+
+	return m.update(order.ID, func(o *Order) error {
+		o.InvoiceMessageID = sent.Result.MessageID
+		return nil
+	})
+}
+
+// Get returns the order with given id.
+func (m *OrderManager) Get(id string) (order Order, exists bool, err error) {
+	item, err := m.storage.Get(orderKeyPrefix + id)
+	if err != nil {
+		return order, false, fmt.Errorf("failed to load order: %w", err)
+	}
+	if item == nil {
+		return order, false, nil
+	}
+	if err = json.Unmarshal(item.Value, &order); err != nil {
+		return order, false, fmt.Errorf("failed to parse order: %w", err)
+	}
+	return order, true, nil
+}
+
+// Orders returns all orders in the order of creation.
+func (m *OrderManager) Orders() ([]Order, error) {
+	items, err := m.storage.List(orderKeyPrefix)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load orders: %w", err)
+	}
+
+	orders := []Order{}
+	for _, item := range items {
+		var order Order
+		if err = json.Unmarshal(item.Value, &order); err != nil {
+			return nil, fmt.Errorf("failed to parse order: %w", err)
+		}
+		orders = append(orders, order)
+	}
+	sort.Slice(orders, func(i, j int) bool {
+		return orders[i].CreatedAt.Before(orders[j].CreatedAt)
+	})
+
+	return orders, nil
+}
+
+// Cancel cancels the order with given id. (paid orders cannot be cancelled)
+func (m *OrderManager) Cancel(id string) (Order, error) {
+	return m.update(id, func(o *Order) error {
+		if o.Status == OrderStatusPaid {
+			return fmt.Errorf("order is already paid: %s", o.ID)
+		}
+		o.Status = OrderStatusCancelled
+		return nil
+	})
+}
+
+// HandleShippingQuery answers given shipping query with the shipping options from the hook.
+func (m *OrderManager) HandleShippingQuery(query ShippingQuery) {
+	order, err := m.orderForPayload(query.InvoicePayload)
+	if err == nil && (order.Status != OrderStatusPending && order.Status != OrderStatusApproved) {
+		err = fmt.Errorf("order is %s", order.Status)
+	}
+	if err == nil && m.config.ShippingOptions == nil {
+		err = fmt.Errorf("no hook for shipping options")
+	}
+	if err != nil {
+		m.b.error("rejecting shipping query %s: %s", query.ID, err)
+		m.answerShippingQuery(query.ID, nil, m.config.ErrorMessage)
+		return
+	}
+
+	var options []ShippingOption
+	if err = m.runHook(func() (err error) {
+		options, err = m.config.ShippingOptions(m.b, order, query.ShippingAddress)
+		return err
+	}); err != nil {
+		m.answerShippingQuery(query.ID, nil, m.userMessageOf(err))
+		return
+	}
+	if len(options) == 0 {
+		m.answerShippingQuery(query.ID, nil, m.config.ErrorMessage)
+		return
+	}
+
+	// keep offered options for verifying the total amount at pre-checkout
+	if _, err = m.update(order.ID, func(o *Order) error {
+		o.ShippingOptions = options
+		return nil
+	}); err != nil {
+		m.b.error("failed to save shipping options of order %s: %s", order.ID, err)
+		m.answerShippingQuery(query.ID, nil, m.config.ErrorMessage)
+		return
+	}
+
+	m.answerShippingQuery(query.ID, options, "")
+}
+
+// HandlePreCheckoutQuery verifies given pre-checkout query with its order and the validation hook, and answers it.
+func (m *OrderManager) HandlePreCheckoutQuery(query PreCheckoutQuery) {
+	order, err := m.orderForPayload(query.InvoicePayload)
+	if err == nil {
+		err = m.verifyCheckout(order, query)
+	}
+	if err != nil {
+		m.b.error("rejecting pre-checkout query %s: %s", query.ID, err)
+		m.answerPreCheckoutQuery(query.ID, m.config.ErrorMessage)
+		return
+	}
+
+	if m.config.ValidateOrder != nil {
+		if err = m.runHook(func() error {
+			return m.config.ValidateOrder(m.b, order, query)
+		}); err != nil {
+			m.answerPreCheckoutQuery(query.ID, m.userMessageOf(err))
+			return
+		}
+	}
+
+	if _, err = m.update(order.ID, func(o *Order) error {
+		if o.Status != OrderStatusPending && o.Status != OrderStatusApproved {
+			return fmt.Errorf("order is %s", o.Status)
+		}
+		o.Status = OrderStatusApproved
+		o.OrderInfo = query.OrderInfo
+		if query.ShippingOptionID != nil {
+			o.ShippingOptionID = *query.ShippingOptionID
+		}
+		return nil
+	}); err != nil {
+		m.b.error("rejecting pre-checkout query %s: %s", query.ID, err)
+		m.answerPreCheckoutQuery(query.ID, m.config.ErrorMessage)
+		return
+	}
+
+	m.answerPreCheckoutQuery(query.ID, "")
+}
+
+// HandleSuccessfulPayment records the successful payment of given message to its order.
+//
+// It is idempotent: the same charge is recorded (and OnPaid is called) only once.
+func (m *OrderManager) HandleSuccessfulPayment(message Message) (order Order, err error) {
+	payment := message.SuccessfulPayment
+	if payment == nil {
+		return order, fmt.Errorf("message has no successful payment")
+	}
+
+	order, err = m.orderForPayload(payment.InvoicePayload)
+	if err != nil {
+		return order, err
+	}
+
+	newlyPaid := false
+	if order, err = m.update(order.ID, func(o *Order) error {
+		if o.Payment != nil {
+			if o.Payment.TelegramPaymentChargeID == payment.TelegramPaymentChargeID {
+				newlyPaid = false
+				return nil // already recorded
+			}
+			return fmt.Errorf("order %s is already paid with another charge: %s (new: %s)", o.ID, o.Payment.TelegramPaymentChargeID, payment.TelegramPaymentChargeID)
+		}
+
+		o.Status = OrderStatusPaid
+		o.Payment = payment
+		o.PaidAt = time.Unix(int64(message.Date), 0)
+		if payment.ShippingOptionID != nil {
+			o.ShippingOptionID = *payment.ShippingOptionID
+		}
+		if payment.OrderInfo != nil {
+			o.OrderInfo = payment.OrderInfo
+		}
+		newlyPaid = true
+		return nil
+	}); err != nil {
+		m.b.error("failed to record payment: %s", err)
+		return order, err
+	}
+
+	if newlyPaid {
+		if expected := m.expectedAmount(order); payment.Currency != order.Currency || payment.TotalAmount != expected {
+			m.b.error("paid amount of order %s differs: %d %s (expected: %d %s)", order.ID, payment.TotalAmount, payment.Currency, expected, order.Currency)
+		}
+
+		if m.config.OnPaid != nil {
+			m.config.OnPaid(m.b, order)
+		}
+	}
+
+	return order, nil
+}
+
+// Observe handles payment updates (shipping queries, pre-checkout queries, and successful payments) of this manager.
+//
+// Returns true if given update was handled.
+func (m *OrderManager) Observe(update Update) bool {
+	switch {
+	case update.ShippingQuery != nil && m.isOrderPayload(update.ShippingQuery.InvoicePayload):
+		m.HandleShippingQuery(*update.ShippingQuery)
+		return true
+	case update.PreCheckoutQuery != nil && m.isOrderPayload(update.PreCheckoutQuery.InvoicePayload):
+		m.HandlePreCheckoutQuery(*update.PreCheckoutQuery)
+		return true
+	case update.Message != nil && update.Message.SuccessfulPayment != nil && m.isOrderPayload(update.Message.SuccessfulPayment.InvoicePayload):
+		m.HandleSuccessfulPayment(*update.Message)
+		return true
+	}
+	return false
+}
+
+// Middleware returns a middleware which handles payment updates of this manager.
+//
+// Shipping and pre-checkout queries are answered here and not passed to the next handlers,
+// but successful payment messages are passed after being recorded.
+func (m *OrderManager) Middleware() Middleware {
+	return func(next Handler) Handler {
+		return HandlerFunc(func(ctx *UpdateContext) {
+			if ctx.Err == nil && m.Observe(ctx.Update) && ctx.Update.Message == nil {
+				return
+			}
+
+			next.HandleUpdate(ctx)
+		})
+	}
+}
+
+// Check if given invoice payload is of an order.
+func (m *OrderManager) isOrderPayload(payload string) bool {
+	return strings.HasPrefix(payload, orderPayloadPrefix)
+}
+
+// Load the order of given invoice payload.
+func (m *OrderManager) orderForPayload(payload string) (order Order, err error) {
+	if !m.isOrderPayload(payload) {
+		return order, fmt.Errorf("invalid invoice payload: %s", payload)
+	}
+
+	order, exists, err := m.Get(strings.TrimPrefix(payload, orderPayloadPrefix))
+	if err == nil && !exists {
+		err = fmt.Errorf("no such order for invoice payload: %s", payload)
+	}
+	return order, err
+}
+
+// Verify given pre-checkout query with its order.
+func (m *OrderManager) verifyCheckout(order Order, query PreCheckoutQuery) error {
+	if order.Status != OrderStatusPending && order.Status != OrderStatusApproved {
+		return fmt.Errorf("order is %s", order.Status)
+	}
+	if order.UserID != 0 && order.UserID != query.From.ID {
+		return fmt.Errorf("order is not for user: %d", query.From.ID)
+	}
+
+	if query.ShippingOptionID != nil {
+		order.ShippingOptionID = *query.ShippingOptionID
+		if _, exists := order.ShippingAmount(order.ShippingOptionID); !exists {
+			return fmt.Errorf("shipping option was not offered: %s", order.ShippingOptionID)
+		}
+	} else {
+		order.ShippingOptionID = ""
+	}
+	if expected := m.expectedAmount(order); query.Currency != order.Currency || query.TotalAmount != expected {
+		return fmt.Errorf("amount differs: %d %s (expected: %d %s)", query.TotalAmount, query.Currency, expected, order.Currency)
+	}
+
+	return nil
+}
+
+// Expected total amount of given order. (with shipping)
+func (m *OrderManager) expectedAmount(order Order) int {
+	shipping, _ := order.ShippingAmount(order.ShippingOptionID)
+	return order.TotalAmount() + shipping
+}
+
+// Run given hook with timeout. (panics are recovered as errors)
+func (m *OrderManager) runHook(hook func() error) error {
+	done := make(chan error, 1)
+	go func() {
+		defer func() {
+			if r := recover(); r != nil {
+				m.b.error("panic in payment hook: %v", r)
+				done <- errors.New(m.config.ErrorMessage)
+			}
+		}()
+
+		done <- hook()
+	}()
+
+	select {
+	case err := <-done:
+		return err
+	case <-time.After(time.Duration(m.config.HookTimeoutSeconds) * time.Second):
+		m.b.error("payment hook timed out after %d seconds", m.config.HookTimeoutSeconds)
+		return errors.New(m.config.ErrorMessage)
+	}
+}
+
+// Return the message of given error for users.
+func (m *OrderManager) userMessageOf(err error) string {
+	if message := err.Error(); message != "" {
+		return message
+	}
+	return m.config.ErrorMessage
+}
+
+// Answer a shipping query. (errorMessage is used when options are empty)
+func (m *OrderManager) answerShippingQuery(queryID string, options []ShippingOption, errorMessage string) {
+	var answered APIResponseBool
+	if len(options) > 0 {
+		answered = m.b.AnswerShippingQuery(queryID, true, options, nil)
+	} else {
+		answered = m.b.AnswerShippingQuery(queryID, false, nil, &errorMessage)
+	}
+	if !answered.Ok {
+		m.b.error("failed to answer shipping query %s: %s", queryID, descriptionOf(answered.APIResponseBase))
+	}
+}
+
+// Answer a pre-checkout query. (ok when errorMessage is empty)
+func (m *OrderManager) answerPreCheckoutQuery(queryID string, errorMessage string) {
+	var answered APIResponseBool
+	if errorMessage == "" {
+		answered = m.b.AnswerPreCheckoutQuery(queryID, true, nil)
+	} else {
+		answered = m.b.AnswerPreCheckoutQuery(queryID, false, &errorMessage)
+	}
+	if !answered.Ok {
+		m.b.error("failed to answer pre-checkout query %s: %s", queryID, descriptionOf(answered.APIResponseBase))
+	}
+}
+
+// Load, change, and save the order with given id. (retried on conflicts)
+func (m *OrderManager) update(id string, change func(o *Order) error) (order Order, err error) {
+	for i := 0; i < maxOrderUpdateRetries; i++ {
+		var item *StorageItem
+		if item, err = m.storage.Get(orderKeyPrefix + id); err != nil {
+			return order, fmt.Errorf("failed to load order: %w", err)
+		}
+		if item == nil {
+			return order, fmt.Errorf("no such order: %s", id)
+		}
+
+		order = Order{}
+		if err = json.Unmarshal(item.Value, &order); err != nil {
+			return order, fmt.Errorf("failed to parse order: %w", err)
+		}
+		if err = change(&order); err != nil {
+			return order, err
+		}
+		order.UpdatedAt = time.Now()
+
+		if err = m.save(order, item.Version); err != ErrStorageConflict {
+			return order, err
+		}
+	}
+	return order, err
+}
+
+// Save given order. (version = 0 when it should be a new one)
+func (m *OrderManager) save(order Order, version uint64) error {
+	bytes, err := json.Marshal(order)
+	if err != nil {
+		return fmt.Errorf("failed to serialize order: %w", err)
+	}
+	if _, err = m.storage.CompareAndSwap(orderKeyPrefix+order.ID, version, bytes, 0); err != nil {
+		if err == ErrStorageConflict {
+			return err
+		}
+		return fmt.Errorf("failed to save order: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,430 @@
+package telegrambot
+
+// Managing polls: tracking results, closing at deadlines, and exporting results
+//
+// https://core.telegram.org/bots/api#sendpoll
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"html"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	pollKeyPrefix      = "poll:"
+	pollCloseJobPrefix = "close_poll:"
+	pollCloseAction    = "close_poll"
+
+	maxPollUpdateRetries = 5
+	defaultPollBarWidth  = 20
+)
+
+// PollRecord is a stored state of a poll
+type PollRecord struct {
+	PollID    string       `json:"poll_id"`
+	ChatID    int64        `json:"chat_id"`
+	MessageID int          `json:"message_id"`
+	Question  string       `json:"question"`
+	Options   []PollOption `json:"options"`
+	IsClosed  bool         `json:"is_closed"`
+	CreatedAt time.Time    `json:"created_at"`
+	UpdatedAt time.Time    `json:"updated_at"`
+	Deadline  time.Time    `json:"deadline,omitempty"` // zero for no deadline
+}
+
+// TotalVoterCount returns the sum of voter counts of all options.
+func (r PollRecord) TotalVoterCount() int {
+	total := 0
+	for _, option := range r.Options {
+		total += option.VoterCount
+	}
+	return total
+}
+
+// Percentage returns the percentage of voters for the option at given index.
+func (r PollRecord) Percentage(index int) float64 {
+	total := r.TotalVoterCount()
+	if total == 0 || index < 0 || index >= len(r.Options) {
+		return 0
+	}
+	return float64(r.Options[index].VoterCount) * 100 / float64(total)
+}
+
+// Text renders the results as plain text.
+func (r PollRecord) Text() string {
+	var builder strings.Builder
+
+	builder.WriteString(r.Question + "\n")
+	for i, option := range r.Options {
+		builder.WriteString(fmt.Sprintf("- %s: %d (%.1f%%)\n", option.Text, option.VoterCount, r.Percentage(i)))
+	}
+	builder.WriteString(fmt.Sprintf("Total: %d", r.TotalVoterCount()))
+	if r.IsClosed {
+		builder.WriteString(" (closed)")
+	}
+
+	return builder.String()
+}
+
+// BarChart renders the results as a text bar chart with given width of bars. (default: 20)
+func (r PollRecord) BarChart(width int) string {
+	if width <= 0 {
+		width = defaultPollBarWidth
+	}
+
+	max := 0
+	for _, option := range r.Options {
+		if option.VoterCount > max {
+			max = option.VoterCount
+		}
+	}
+
+	var builder strings.Builder
+	builder.WriteString(r.Question + "\n\n")
+	for i, option := range r.Options {
+		filled := 0
+		if max > 0 {
+			filled = option.VoterCount * width / max
+		}
+		builder.WriteString(fmt.Sprintf("%s\n%s%s %d (%.1f%%)\n",
+			option.Text,
+			strings.Repeat("█", filled),
+			strings.Repeat("░", width-filled),
+			option.VoterCount,
+			r.Percentage(i)))
+	}
+	builder.WriteString(fmt.Sprintf("\nTotal: %d", r.TotalVoterCount()))
+	if r.IsClosed {
+		builder.WriteString(" (closed)")
+	}
+
+	return builder.String()
+}
+
+// PollManager creates polls, and keeps track of their states in a storage
+type PollManager struct {
+	b         *Bot
+	storage   Storage
+	scheduler *Scheduler
+
+	sync.RWMutex
+	onUpdated func(b *Bot, record PollRecord)
+	onClosed  func(b *Bot, record PollRecord)
+}
+
+// NewPollManager generates a new PollManager with given storage.
+//
+// Deadlines of polls are scheduled with given scheduler. (nil for no deadlines)
+func (b *Bot) NewPollManager(storage Storage, scheduler *Scheduler) *PollManager {
+	m := &PollManager{
+		b:         b,
+		storage:   storage,
+		scheduler: scheduler,
+	}
+
+	if scheduler != nil {
+		scheduler.RegisterAction(pollCloseAction, func(b *Bot, job Job) error {
+			_, err := m.Close(job.Data["poll_id"])
+			return err
+		})
+	}
+
+	return m
+}
+
+// OnUpdated sets a handler which is called when a poll's state is changed by an update.
+func (m *PollManager) OnUpdated(handler func(b *Bot, record PollRecord)) *PollManager {
+	m.Lock()
+	defer m.Unlock()
+
+	m.onUpdated = handler
+
+	return m
+}
+
+// OnClosed sets a handler which is called when a poll is closed.
+func (m *PollManager) OnClosed(handler func(b *Bot, record PollRecord)) *PollManager {
+	m.Lock()
+	defer m.Unlock()
+
+	m.onClosed = handler
+
+	return m
+}
+
+// Create sends a new poll to given chat, and records it.
+//
+// The poll will be closed at given deadline. (zero for no deadline)
+func (m *PollManager) Create(chatID int64, question string, pollOptions []string, deadline time.Time, options OptionsSendPoll) (record PollRecord, err error) {
+	if !deadline.IsZero() && m.scheduler == nil {
+		return record, fmt.Errorf("poll manager has no scheduler for deadlines")
+	}
+
+	sent := m.b.SendPoll(chatID, question, pollOptions, options)
+	if !sent.Ok || sent.Result == nil || sent.Result.Poll == nil {
+		return record, fmt.Errorf("failed to send poll: %s", descriptionOf(sent.APIResponseBase))
+	}
+
+	now := m.now()
+	poll := sent.Result.Poll
+	record = PollRecord{
+		PollID:    poll.ID,
+		ChatID:    sent.Result.Chat.ID,
+		MessageID: sent.Result.MessageID,
+		Question:  poll.Question,
+		Options:   poll.Options,
+		IsClosed:  poll.IsClosed,
+		CreatedAt: now,
+		UpdatedAt: now,
+		Deadline:  deadline,
+	}
+	if err = m.save(record, 0); err != nil {
+		return record, err
+	}
+
+	if !deadline.IsZero() {
+		job := NewOneShotJob(pollCloseJobPrefix+record.PollID, deadline).
+			RunAction(pollCloseAction, map[string]string{"poll_id": record.PollID})
+		if _, err = m.scheduler.Schedule(job); err != nil {
+			return record, fmt.Errorf("failed to schedule deadline of poll: %w", err)
+		}
+	}
+
+	return record, nil
+}
+
+// Apply applies given poll (from updates or API responses) to its stored state.
+//
+// Returns false if the poll is not managed by this manager.
+func (m *PollManager) Apply(poll Poll) (record PollRecord, applied bool, err error) {
+	var wasClosed bool
+	for i := 0; i < maxPollUpdateRetries; i++ {
+		var item *StorageItem
+		if item, err = m.storage.Get(pollKeyPrefix + poll.ID); err != nil {
+			return record, false, fmt.Errorf("failed to load poll: %w", err)
+		}
+		if item == nil {
+			return record, false, nil
+		}
+		if err = json.Unmarshal(item.Value, &record); err != nil {
+			return record, false, fmt.Errorf("failed to parse poll: %w", err)
+		}
+
+		wasClosed = record.IsClosed
+		record.Question = poll.Question
+		record.Options = poll.Options
+		record.IsClosed = record.IsClosed || poll.IsClosed
+		record.UpdatedAt = m.now()
+
+		if err = m.save(record, item.Version); err != ErrStorageConflict {
+			break
+		}
+	}
+	if err != nil {
+		return record, false, err
+	}
+
+	m.RLock()
+	onUpdated, onClosed := m.onUpdated, m.onClosed
+	m.RUnlock()
+
+	if onUpdated != nil {
+		onUpdated(m.b, record)
+	}
+	if record.IsClosed && !wasClosed {
+		if m.scheduler != nil && !record.Deadline.IsZero() {
+			// the poll is already closed, so just log the error of the (now unnecessary) deadline job
+			if err := m.scheduler.Cancel(pollCloseJobPrefix + record.PollID); err != nil {
+				m.b.error("failed to cancel deadline of poll '%s': %s", record.PollID, err)
+			}
+		}
+		if onClosed != nil {
+			onClosed(m.b, record)
+		}
+	}
+
+	return record, true, nil
+}
+
+// Close stops the poll with given id, and applies its final state.
+func (m *PollManager) Close(pollID string) (record PollRecord, err error) {
+	record, exists, err := m.Get(pollID)
+	if err != nil {
+		return record, err
+	}
+	if !exists {
+		return record, fmt.Errorf("no such poll: %s", pollID)
+	}
+	if record.IsClosed {
+		return record, nil
+	}
+
+	stopped := m.b.StopPoll(record.ChatID, record.MessageID, nil)
+	if !stopped.Ok || stopped.Result == nil {
+		return record, fmt.Errorf("failed to stop poll: %s", descriptionOf(stopped.APIResponseBase))
+	}
+
+	record, _, err = m.Apply(*stopped.Result)
+	return record, err
+}
+
+// Observe applies the poll of given update, if any.
+func (m *PollManager) Observe(update Update) {
+	if update.Poll != nil {
+		if _, _, err := m.Apply(*update.Poll); err != nil {
+			m.b.error("failed to apply poll update: %s", err)
+		}
+	}
+}
+
+// Middleware returns a middleware which applies poll updates before passing them to the next handlers.
+func (m *PollManager) Middleware() Middleware {
+	return func(next Handler) Handler {
+		return HandlerFunc(func(ctx *UpdateContext) {
+			if ctx.Err == nil {
+				m.Observe(ctx.Update)
+			}
+
+			next.HandleUpdate(ctx)
+		})
+	}
+}
+
+// Get returns the stored state of the poll with given id.
+func (m *PollManager) Get(pollID string) (record PollRecord, exists bool, err error) {
+	item, err := m.storage.Get(pollKeyPrefix + pollID)
+	if err != nil {
+		return record, false, fmt.Errorf("failed to load poll: %w", err)
+	}
+	if item == nil {
+		return record, false, nil
+	}
+	if err = json.Unmarshal(item.Value, &record); err != nil {
+		return record, false, fmt.Errorf("failed to parse poll: %w", err)
+	}
+	return record, true, nil
+}
+
+// Polls returns stored states of all polls in the order of creation.
+func (m *PollManager) Polls() ([]PollRecord, error) {
+	items, err := m.storage.List(pollKeyPrefix)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load polls: %w", err)
+	}
+
+	records := []PollRecord{}
+	for _, item := range items {
+		var record PollRecord
+		if err = json.Unmarshal(item.Value, &record); err != nil {
+			return nil, fmt.Errorf("failed to parse poll: %w", err)
+		}
+		records = append(records, record)
+	}
+	sort.Slice(records, func(i, j int) bool {
+		return records[i].CreatedAt.Before(records[j].CreatedAt)
+	})
+
+	return records, nil
+}
+
+// Delete deletes the stored state (and the deadline) of the poll with given id.
+func (m *PollManager) Delete(pollID string) error {
+	if m.scheduler != nil {
+		if err := m.scheduler.Cancel(pollCloseJobPrefix + pollID); err != nil {
+			return err
+		}
+	}
+	return m.storage.Delete(pollKeyPrefix + pollID)
+}
+
+// SendResults sends the results of the poll with given id as a bar chart message.
+func (m *PollManager) SendResults(chatID ChatID, pollID string, options OptionsSendMessage) (result APIResponseMessage) {
+	record, exists, err := m.Get(pollID)
+	if err == nil && !exists {
+		err = fmt.Errorf("no such poll: %s", pollID)
+	}
+	if err != nil {
+		errStr := err.Error()
+		return APIResponseMessage{APIResponseBase: APIResponseBase{Ok: false, Description: &errStr}}
+	}
+
+	if options == nil {
+		options = map[string]interface{}{}
+	}
+	options["parse_mode"] = ParseModeHTML
+
+	return m.b.SendMessage(chatID, "<pre>"+html.EscapeString(record.BarChart(0))+"</pre>", options)
+}
+
+// ExportCSV writes the results of polls with given ids (all polls if none) to given writer in CSV format.
+//
+// Columns: poll_id, chat_id, message_id, question, option, voter_count, percentage, is_closed
+func (m *PollManager) ExportCSV(w io.Writer, pollIDs ...string) error {
+	var records []PollRecord
+	if len(pollIDs) == 0 {
+		var err error
+		if records, err = m.Polls(); err != nil {
+			return err
+		}
+	} else {
+		for _, pollID := range pollIDs {
+			record, exists, err := m.Get(pollID)
+			if err != nil {
+				return err
+			}
+			if exists {
+				records = append(records, record)
+			}
+		}
+	}
+
+	writer := csv.NewWriter(w)
+	writer.Write([]string{"poll_id", "chat_id", "message_id", "question", "option", "voter_count", "percentage", "is_closed"})
+	for _, record := range records {
+		for i, option := range record.Options {
+			writer.Write([]string{
+				record.PollID,
+				strconv.FormatInt(record.ChatID, 10),
+				strconv.Itoa(record.MessageID),
+				record.Question,
+				option.Text,
+				strconv.Itoa(option.VoterCount),
+				strconv.FormatFloat(record.Percentage(i), 'f', 2, 64),
+				strconv.FormatBool(record.IsClosed),
+			})
+		}
+	}
+	writer.Flush()
+
+	return writer.Error()
+}
+
+// Current time. (from the scheduler's clock if any)
+func (m *PollManager) now() time.Time {
+	if m.scheduler != nil {
+		return m.scheduler.clock.Now()
+	}
+	return time.Now()
+}
+
+// Save given record. (version = 0 when it should be a new one)
+func (m *PollManager) save(record PollRecord, version uint64) error {
+	bytes, err := json.Marshal(record)
+	if err != nil {
+		return fmt.Errorf("failed to serialize poll: %w", err)
+	}
+	if _, err = m.storage.CompareAndSwap(pollKeyPrefix+record.PollID, version, bytes, 0); err != nil {
+		if err == ErrStorageConflict {
+			return err
+		}
+		return fmt.Errorf("failed to save poll: %w", err)
+	}
+	return nil
+}
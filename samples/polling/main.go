@@ -138,7 +138,7 @@ func main() {
 		)
 
 		// delete webhook (getting updates will not work when wehbook is set up)
-		if unhooked := client.DeleteWebhook(); unhooked.Ok {
+		if unhooked := client.DeleteWebhook(nil); unhooked.Ok {
 			// wait for new updates
 			client.StartMonitoringUpdates(
 				0,
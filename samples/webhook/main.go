@@ -144,7 +144,7 @@ func main() {
 		)
 
 		// delete webhook
-		if unhooked := client.DeleteWebhook(); unhooked.Ok {
+		if unhooked := client.DeleteWebhook(nil); unhooked.Ok {
 			// generate certificate and private key for testing
 			if err := bot.GenCertAndKey(
 				webhookHost,
@@ -0,0 +1,499 @@
+package telegrambot
+
+// Scheduling one-shot and recurring jobs (eg. sending messages periodically)
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+)
+
+const (
+	jobKeyPrefix = "job:"
+
+	maxSchedulerWaitDuration = time.Minute // for noticing changes of clock (eg. after suspension)
+	maxMissedRunsToCatchUp   = 100
+)
+
+// Clock is an interface of clocks for Scheduler (can be replaced for tests)
+type Clock interface {
+	Now() time.Time
+	After(d time.Duration) <-chan time.Time
+}
+
+// system clock
+type systemClock struct{}
+
+func (systemClock) Now() time.Time                         { return time.Now() }
+func (systemClock) After(d time.Duration) <-chan time.Time { return time.After(d) }
+
+// SystemClock is the default Clock which uses the system time
+var SystemClock Clock = systemClock{}
+
+// MissedRunPolicy is a policy for runs which were missed (eg. while the bot was not running)
+type MissedRunPolicy string
+
+// MissedRunPolicy strings
+const (
+	MissedRunSkip MissedRunPolicy = "skip" // skip missed runs
+	MissedRunOnce MissedRunPolicy = "once" // run once for all missed runs
+	MissedRunAll  MissedRunPolicy = "all"  // run for each missed run (at most 100 times)
+)
+
+// Job is a struct of a scheduled job
+//
+// A job calls an API method with parameters, or a registered action. (see Scheduler.RegisterAction)
+type Job struct {
+	ID string `json:"id"`
+
+	// schedule: Cron for recurring jobs, or At for one-shot jobs
+	Cron     string    `json:"cron,omitempty"`
+	At       time.Time `json:"at,omitempty"`
+	Timezone string    `json:"timezone,omitempty"` // location name for Cron (default: UTC)
+
+	// what to run: Method with Params, or Action with Data
+	Method string                 `json:"method,omitempty"`
+	Params map[string]interface{} `json:"params,omitempty"`
+	Action string                 `json:"action,omitempty"`
+	Data   map[string]string      `json:"data,omitempty"`
+
+	MissedRunPolicy MissedRunPolicy `json:"missed_run_policy,omitempty"` // default: MissedRunOnce
+
+	NextRunAt time.Time `json:"next_run_at"`
+	LastRunAt time.Time `json:"last_run_at,omitempty"`
+	LastError string    `json:"last_error,omitempty"`
+
+	revision uint64 // changes when the job is (re)scheduled, for not overwriting replaced jobs with stale ones
+}
+
+// NewCronJob generates a recurring job with given id and cron expression. (see ParseCron)
+func NewCronJob(id, cron string) Job {
+	return Job{ID: id, Cron: cron}
+}
+
+// NewOneShotJob generates a one-shot job with given id and time.
+func NewOneShotJob(id string, at time.Time) Job {
+	return Job{ID: id, At: at}
+}
+
+// SetTimezone sets the timezone of the job's cron expression. (eg. "Asia/Seoul")
+func (j Job) SetTimezone(timezone string) Job {
+	j.Timezone = timezone
+	return j
+}
+
+// SetMissedRunPolicy sets the policy for missed runs of the job.
+func (j Job) SetMissedRunPolicy(policy MissedRunPolicy) Job {
+	j.MissedRunPolicy = policy
+	return j
+}
+
+// CallMethod sets the API method and parameters to be called by the job.
+func (j Job) CallMethod(method string, params map[string]interface{}) Job {
+	j.Method, j.Params = method, params
+	return j
+}
+
+// RunAction sets the registered action and data to be run by the job.
+func (j Job) RunAction(action string, data map[string]string) Job {
+	j.Action, j.Data = action, data
+	return j
+}
+
+// SendMessage sets the job to send a message.
+func (j Job) SendMessage(chatID ChatID, text string, options OptionsSendMessage) Job {
+	if options == nil {
+		options = map[string]interface{}{}
+	}
+	options["chat_id"] = chatID
+	options["text"] = text
+
+	return j.CallMethod("sendMessage", options)
+}
+
+// PinChatMessage sets the job to pin a message.
+func (j Job) PinChatMessage(chatID ChatID, messageID int, options OptionsPinChatMessage) Job {
+	if options == nil {
+		options = map[string]interface{}{}
+	}
+	options["chat_id"] = chatID
+	options["message_id"] = messageID
+
+	return j.CallMethod("pinChatMessage", options)
+}
+
+// UnpinChatMessage sets the job to unpin the pinned message.
+func (j Job) UnpinChatMessage(chatID ChatID) Job {
+	return j.CallMethod("unpinChatMessage", map[string]interface{}{
+		"chat_id": chatID,
+	})
+}
+
+// DeleteMessage sets the job to delete a message.
+func (j Job) DeleteMessage(chatID ChatID, messageID int) Job {
+	return j.CallMethod("deleteMessage", map[string]interface{}{
+		"chat_id":    chatID,
+		"message_id": messageID,
+	})
+}
+
+// Check if the job is recurring.
+func (j Job) recurring() bool {
+	return j.Cron != ""
+}
+
+// Calculate the next run time after given time. (zero if there is no more runs)
+func (j Job) nextRunAfter(after time.Time) (time.Time, error) {
+	if !j.recurring() {
+		if j.At.After(after) {
+			return j.At, nil
+		}
+		return time.Time{}, nil
+	}
+
+	schedule, err := ParseCron(j.Cron)
+	if err != nil {
+		return time.Time{}, err
+	}
+	loc := time.UTC
+	if j.Timezone != "" {
+		if loc, err = time.LoadLocation(j.Timezone); err != nil {
+			return time.Time{}, fmt.Errorf("invalid timezone: %w", err)
+		}
+	}
+
+	return schedule.Next(after.In(loc)), nil
+}
+
+// Scheduler runs scheduled jobs of a bot, and saves them in a Storage
+type Scheduler struct {
+	b       *Bot
+	storage Storage
+	clock   Clock
+
+	sync.Mutex
+	jobs     map[string]Job
+	actions  map[string]func(b *Bot, job Job) error
+	running  map[string]bool
+	revision uint64 // last revision given to jobs
+	wake     chan struct{}
+	quit     chan struct{}
+	done     chan struct{}
+}
+
+// NewScheduler generates a new Scheduler which saves jobs in given storage, and loads the saved ones.
+//
+// If clock is nil, SystemClock will be used.
+func (b *Bot) NewScheduler(storage Storage, clock Clock) (*Scheduler, error) {
+	if clock == nil {
+		clock = SystemClock
+	}
+
+	s := &Scheduler{
+		b:       b,
+		storage: storage,
+		clock:   clock,
+		jobs:    map[string]Job{},
+		actions: map[string]func(b *Bot, job Job) error{},
+		running: map[string]bool{},
+		wake:    make(chan struct{}, 1),
+	}
+
+	items, err := storage.List(jobKeyPrefix)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load jobs: %w", err)
+	}
+	for _, item := range items {
+		decoder := json.NewDecoder(bytes.NewReader(item.Value))
+		decoder.UseNumber() // for keeping large integers (eg. chat ids) in params
+
+		var job Job
+		if err = decoder.Decode(&job); err != nil {
+			return nil, fmt.Errorf("failed to parse job: %w", err)
+		}
+		s.revision++
+		job.revision = s.revision
+		s.jobs[job.ID] = job
+	}
+
+	return s, nil
+}
+
+// RegisterAction registers an action which can be run by jobs. (see Job.RunAction)
+func (s *Scheduler) RegisterAction(name string, action func(b *Bot, job Job) error) *Scheduler {
+	s.Lock()
+	defer s.Unlock()
+
+	s.actions[name] = action
+
+	return s
+}
+
+// Schedule adds (or replaces) given job, and returns it with its next run time.
+func (s *Scheduler) Schedule(job Job) (Job, error) {
+	if job.ID == "" {
+		return job, fmt.Errorf("job has no id")
+	}
+	if (job.Method == "") == (job.Action == "") {
+		return job, fmt.Errorf("job should have either a method or an action: %s", job.ID)
+	}
+	if job.recurring() == !job.At.IsZero() {
+		return job, fmt.Errorf("job should have either a cron expression or a time: %s", job.ID)
+	}
+	if job.MissedRunPolicy == "" {
+		job.MissedRunPolicy = MissedRunOnce
+	}
+
+	now := s.clock.Now()
+	if job.recurring() {
+		next, err := job.nextRunAfter(now)
+		if err != nil {
+			return job, err
+		}
+		if next.IsZero() {
+			return job, fmt.Errorf("cron expression never matches: %s", job.Cron)
+		}
+		job.NextRunAt = next
+	} else {
+		job.NextRunAt = job.At // past one-shot jobs run immediately
+	}
+
+	s.Lock()
+	defer s.Unlock()
+
+	if err := s.save(job); err != nil {
+		return job, err
+	}
+	s.revision++
+	job.revision = s.revision
+	s.jobs[job.ID] = job
+
+	s.notify()
+
+	return job, nil
+}
+
+// Cancel removes the job with given id.
+func (s *Scheduler) Cancel(id string) error {
+	s.Lock()
+	defer s.Unlock()
+
+	delete(s.jobs, id)
+
+	return s.storage.Delete(jobKeyPrefix + id)
+}
+
+// Jobs returns all scheduled jobs in the order of their next run times.
+func (s *Scheduler) Jobs() []Job {
+	s.Lock()
+	defer s.Unlock()
+
+	jobs := []Job{}
+	for _, job := range s.jobs {
+		jobs = append(jobs, job)
+	}
+	sort.Slice(jobs, func(i, j int) bool {
+		return jobs[i].NextRunAt.Before(jobs[j].NextRunAt)
+	})
+
+	return jobs
+}
+
+// Start starts running jobs in background.
+func (s *Scheduler) Start() {
+	s.Lock()
+	defer s.Unlock()
+
+	if s.quit != nil {
+		return // already started
+	}
+
+	s.b.verbose("starting scheduler with %d job(s)...", len(s.jobs))
+
+	quit, done := make(chan struct{}), make(chan struct{})
+	s.quit, s.done = quit, done
+
+	go func() {
+		defer close(done)
+
+		for {
+			s.Tick()
+
+			select {
+			case <-quit:
+				return
+			case <-s.wake:
+			case <-s.clock.After(s.waitDuration()):
+			}
+		}
+	}()
+}
+
+// Stop stops running jobs, and waits for the running ones.
+func (s *Scheduler) Stop() {
+	s.Lock()
+	quit, done := s.quit, s.done
+	s.quit, s.done = nil, nil
+	s.Unlock()
+
+	if quit != nil {
+		s.b.verbose("stopping scheduler...")
+
+		close(quit)
+		<-done
+	}
+}
+
+// Tick runs the jobs which are due at the clock's current time. (called periodically after Start)
+//
+// It can be called manually with a fake clock for tests.
+func (s *Scheduler) Tick() {
+	now := s.clock.Now()
+
+	s.Lock()
+	due := []Job{}
+	for _, job := range s.jobs {
+		if !job.NextRunAt.After(now) && !s.running[job.ID] {
+			due = append(due, job)
+			s.running[job.ID] = true
+		}
+	}
+	s.Unlock()
+
+	sort.Slice(due, func(i, j int) bool {
+		return due[i].NextRunAt.Before(due[j].NextRunAt)
+	})
+
+	for _, job := range due {
+		s.runDue(job, now)
+	}
+}
+
+// Run a due job (with its missed runs), and reschedule or remove it.
+func (s *Scheduler) runDue(job Job, now time.Time) {
+	defer func() {
+		s.Lock()
+		delete(s.running, job.ID)
+		s.Unlock()
+	}()
+
+	// count missed runs
+	runs := 1
+	next, err := job.nextRunAfter(job.NextRunAt)
+	for err == nil && !next.IsZero() && !next.After(now) {
+		if job.MissedRunPolicy == MissedRunAll && runs < maxMissedRunsToCatchUp {
+			runs++
+		}
+		next, err = job.nextRunAfter(next)
+	}
+	if err != nil {
+		s.b.error("failed to calculate next run of job '%s': %s", job.ID, err)
+		next = time.Time{}
+	}
+
+	if job.MissedRunPolicy == MissedRunSkip && now.Sub(job.NextRunAt) > maxSchedulerWaitDuration {
+		s.b.verbose("skipping missed run of job '%s' at %s", job.ID, job.NextRunAt)
+		runs = 0
+	}
+
+	for i := 0; i < runs; i++ {
+		job.LastRunAt, job.LastError = now, ""
+		if err := s.run(job); err != nil {
+			job.LastError = err.Error()
+			s.b.error("failed to run job '%s': %s", job.ID, err)
+		}
+	}
+
+	s.Lock()
+	defer s.Unlock()
+
+	if current, exists := s.jobs[job.ID]; !exists {
+		return // cancelled while running
+	} else if current.revision != job.revision {
+		return // replaced while running
+	}
+
+	if next.IsZero() { // no more runs
+		delete(s.jobs, job.ID)
+		if err := s.storage.Delete(jobKeyPrefix + job.ID); err != nil {
+			s.b.error("failed to delete finished job '%s': %s", job.ID, err)
+		}
+		return
+	}
+
+	job.NextRunAt = next
+	s.jobs[job.ID] = job
+	if err := s.save(job); err != nil {
+		s.b.error("failed to save job '%s': %s", job.ID, err)
+	}
+}
+
+// Run a job once.
+func (s *Scheduler) run(job Job) error {
+	if job.Method != "" {
+		params := map[string]interface{}{}
+		for key, value := range job.Params {
+			params[key] = value
+		}
+
+		if res := s.b.requestResponseBase(job.Method, params); !res.Ok {
+			return fmt.Errorf("%s failed: %s", job.Method, descriptionOf(res))
+		}
+		return nil
+	}
+
+	s.Lock()
+	action, exists := s.actions[job.Action]
+	s.Unlock()
+
+	if !exists {
+		return fmt.Errorf("no such action: %s", job.Action)
+	}
+
+	return action(s.b, job)
+}
+
+// Get the duration to wait until the next run.
+func (s *Scheduler) waitDuration() time.Duration {
+	now := s.clock.Now()
+	wait := maxSchedulerWaitDuration
+
+	s.Lock()
+	defer s.Unlock()
+
+	for _, job := range s.jobs {
+		if d := job.NextRunAt.Sub(now); d < wait {
+			wait = d
+		}
+	}
+	if wait < 0 {
+		wait = 0
+	}
+
+	return wait
+}
+
+// Save a job in storage. (lock should be held)
+func (s *Scheduler) save(job Job) error {
+	bytes, err := json.Marshal(job)
+	if err != nil {
+		return fmt.Errorf("failed to serialize job: %w", err)
+	}
+
+	if _, err = s.storage.Set(jobKeyPrefix+job.ID, bytes, 0); err != nil {
+		return fmt.Errorf("failed to save job: %w", err)
+	}
+
+	return nil
+}
+
+// Wake up the running loop for rescheduling. (lock should be held)
+func (s *Scheduler) notify() {
+	select {
+	case s.wake <- struct{}{}:
+	default:
+	}
+}
@@ -0,0 +1,176 @@
+package telegrambot
+
+import (
+	"sync"
+	"testing"
+	"time"
+)
+
+// clock for tests, which moves only when it is set
+type fakeClock struct {
+	sync.Mutex
+	now time.Time
+}
+
+func (c *fakeClock) Now() time.Time {
+	c.Lock()
+	defer c.Unlock()
+
+	return c.now
+}
+
+func (c *fakeClock) After(d time.Duration) <-chan time.Time {
+	return make(chan time.Time) // never fires, call Scheduler.Tick instead
+}
+
+func (c *fakeClock) Set(now time.Time) {
+	c.Lock()
+	defer c.Unlock()
+
+	c.now = now
+}
+
+// generate a scheduler with a fake clock, and an action which records its run times
+func newTestScheduler(t *testing.T, now time.Time) (*Scheduler, *fakeClock, *[]time.Time) {
+	clock := &fakeClock{now: now}
+
+	s, err := NewClient("test-token").NewScheduler(NewMemoryStorage(), clock)
+	if err != nil {
+		t.Fatalf("failed to create scheduler: %s", err)
+	}
+
+	runs := []time.Time{}
+	s.RegisterAction("record", func(b *Bot, job Job) error {
+		runs = append(runs, clock.Now())
+		return nil
+	})
+
+	return s, clock, &runs
+}
+
+// schedule given job, failing if it does not return in time
+func scheduleInTime(t *testing.T, s *Scheduler, job Job) Job {
+	type result struct {
+		job Job
+		err error
+	}
+	done := make(chan result, 1)
+	go func() {
+		scheduled, err := s.Schedule(job)
+		done <- result{scheduled, err}
+	}()
+
+	select {
+	case r := <-done:
+		if r.err != nil {
+			t.Fatalf("failed to schedule job '%s': %s", job.ID, r.err)
+		}
+		return r.job
+	case <-time.After(5 * time.Second):
+		t.Fatalf("scheduling job '%s' did not return", job.ID)
+	}
+	return Job{}
+}
+
+func TestSchedulerOneShotJob(t *testing.T) {
+	start := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	s, clock, runs := newTestScheduler(t, start)
+
+	scheduleInTime(t, s, NewOneShotJob("once", start.Add(time.Hour)).RunAction("record", nil))
+
+	s.Tick()
+	if len(*runs) != 0 {
+		t.Errorf("job should not run before its time, but ran %d time(s)", len(*runs))
+	}
+
+	clock.Set(start.Add(time.Hour))
+	s.Tick()
+	if len(*runs) != 1 {
+		t.Errorf("job should run once at its time, but ran %d time(s)", len(*runs))
+	}
+	if jobs := s.Jobs(); len(jobs) != 0 {
+		t.Errorf("finished one-shot job should be removed, but %d job(s) remain", len(jobs))
+	}
+}
+
+func TestSchedulerMissedRuns(t *testing.T) {
+	start := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		policy   MissedRunPolicy
+		expected int
+	}{
+		{MissedRunSkip, 0},
+		{MissedRunOnce, 1},
+		{MissedRunAll, 3},
+	}
+
+	for _, test := range tests {
+		s, clock, runs := newTestScheduler(t, start)
+
+		scheduleInTime(t, s, NewCronJob("daily", "0 9 * * *").SetMissedRunPolicy(test.policy).RunAction("record", nil))
+
+		// 3 runs (01-01, 01-02, 01-03 09:00) were missed
+		clock.Set(time.Date(2026, 1, 3, 12, 0, 0, 0, time.UTC))
+		s.Tick()
+
+		if len(*runs) != test.expected {
+			t.Errorf("policy '%s': expected %d run(s), got %d", test.policy, test.expected, len(*runs))
+		}
+		if jobs := s.Jobs(); len(jobs) != 1 || !jobs[0].NextRunAt.Equal(time.Date(2026, 1, 4, 9, 0, 0, 0, time.UTC)) {
+			t.Errorf("policy '%s': job should be rescheduled to the next day, got %+v", test.policy, jobs)
+		}
+	}
+}
+
+func TestSchedulerReplacedWhileRunning(t *testing.T) {
+	start := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	s, _, _ := newTestScheduler(t, start)
+
+	later := start.Add(24 * time.Hour)
+	s.RegisterAction("reschedule", func(b *Bot, job Job) error {
+		_, err := s.Schedule(NewOneShotJob(job.ID, later).RunAction("reschedule", nil))
+		return err
+	})
+	scheduleInTime(t, s, NewOneShotJob("again", start).RunAction("reschedule", nil))
+
+	s.Tick()
+
+	if jobs := s.Jobs(); len(jobs) != 1 || !jobs[0].NextRunAt.Equal(later) {
+		t.Errorf("job replaced while running should be kept, got %+v", jobs)
+	}
+}
+
+func TestSchedulerDaylightSaving(t *testing.T) {
+	ny := loadTestLocation(t, "America/New_York")
+
+	// spring-forward: 02:30 does not exist on 2026-03-08
+	s, clock, runs := newTestScheduler(t, time.Date(2026, 3, 7, 12, 0, 0, 0, ny))
+
+	job := scheduleInTime(t, s, NewCronJob("spring", "30 2 * * *").SetTimezone("America/New_York").RunAction("record", nil))
+	if expected := time.Date(2026, 3, 9, 2, 30, 0, 0, ny); !job.NextRunAt.Equal(expected) {
+		t.Errorf("spring-forward: expected next run at %s, got %s", expected, job.NextRunAt)
+	}
+
+	clock.Set(time.Date(2026, 3, 9, 2, 30, 0, 0, ny))
+	s.Tick()
+	if len(*runs) != 1 {
+		t.Errorf("spring-forward: expected 1 run, got %d", len(*runs))
+	}
+
+	// fall-back: 01:30 happens twice on 2026-11-01, but runs once
+	s, clock, runs = newTestScheduler(t, time.Date(2026, 10, 31, 12, 0, 0, 0, ny))
+
+	scheduleInTime(t, s, NewCronJob("fall", "30 1 * * *").SetTimezone("America/New_York").RunAction("record", nil))
+
+	for at := time.Date(2026, 11, 1, 0, 0, 0, 0, ny); at.Before(time.Date(2026, 11, 2, 0, 0, 0, 0, ny)); at = at.Add(15 * time.Minute) {
+		clock.Set(at)
+		s.Tick()
+	}
+	if len(*runs) != 1 {
+		t.Errorf("fall-back: expected 1 run, got %d (%v)", len(*runs), *runs)
+	}
+	if jobs := s.Jobs(); len(jobs) != 1 || !jobs[0].NextRunAt.Equal(time.Date(2026, 11, 2, 1, 30, 0, 0, ny)) {
+		t.Errorf("fall-back: job should be rescheduled to the next day, got %+v", jobs)
+	}
+}
@@ -0,0 +1,213 @@
+package telegrambot
+
+// Per-chat and per-user sessions saved in Storage
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+// context keys for values which are set by built-in middleware
+const (
+	ContextKeySession = "session" // *Session, set by SessionMiddleware
+)
+
+const (
+	sessionKeyPrefix = "session:"
+
+	maxSessionSaveRetries = 5
+)
+
+// SessionScope is a scope of sessions
+type SessionScope string
+
+// SessionScope strings
+const (
+	SessionScopeChat     SessionScope = "chat"      // shared by all users in a chat
+	SessionScopeUser     SessionScope = "user"      // shared by all chats of a user
+	SessionScopeChatUser SessionScope = "chat_user" // for each user in each chat
+)
+
+// Session is a struct of session data which is loaded and saved by SessionMiddleware
+type Session struct {
+	Key string
+
+	values  map[string]string
+	loaded  map[string]string // values when loaded (or saved), for merging changes on conflicts
+	version uint64
+	changed bool
+}
+
+// Get returns the value for given key.
+func (s *Session) Get(key string) string {
+	return s.values[key]
+}
+
+// Set sets the value for given key.
+func (s *Session) Set(key, value string) {
+	if s.values == nil {
+		s.values = map[string]string{}
+	}
+	s.values[key] = value
+	s.changed = true
+}
+
+// Delete deletes the value for given key.
+func (s *Session) Delete(key string) {
+	if _, exists := s.values[key]; exists {
+		delete(s.values, key)
+		s.changed = true
+	}
+}
+
+// Clear deletes all values of the session.
+func (s *Session) Clear() {
+	if len(s.values) > 0 {
+		s.values = map[string]string{}
+		s.changed = true
+	}
+}
+
+// SessionFrom returns the session in given context. (nil if SessionMiddleware was not used)
+func SessionFrom(ctx *UpdateContext) *Session {
+	if value, exists := ctx.Get(ContextKeySession); exists {
+		if session, ok := value.(*Session); ok {
+			return session
+		}
+	}
+	return nil
+}
+
+// SessionMiddleware loads the session of each update from given storage before the next handlers,
+// and saves it after them if it was changed. (ttl = 0 for no expiry)
+//
+// Updates without chats or users for the scope are passed without sessions.
+// Changes are saved with compare-and-swap, so concurrent changes of the same session are not overwritten:
+// on conflicts, changed values are merged into the latest ones and saved again. (at most 5 times)
+func SessionMiddleware(storage Storage, scope SessionScope, ttl time.Duration) Middleware {
+	return func(next Handler) Handler {
+		return HandlerFunc(func(ctx *UpdateContext) {
+			key, ok := sessionKey(ctx.Update, scope)
+			if !ok {
+				next.HandleUpdate(ctx)
+				return
+			}
+
+			session, err := loadSession(storage, key)
+			if err != nil {
+				ctx.Bot.error("failed to load session: %s", err)
+
+				next.HandleUpdate(ctx)
+				return
+			}
+			ctx.Set(ContextKeySession, session)
+
+			next.HandleUpdate(ctx)
+
+			if session.changed {
+				if err := saveSession(storage, session, ttl); err != nil {
+					ctx.Bot.error("failed to save session: %s", err)
+				}
+			}
+		})
+	}
+}
+
+// Load a session from storage.
+func loadSession(storage Storage, key string) (*Session, error) {
+	session := &Session{
+		Key:    key,
+		values: map[string]string{},
+	}
+
+	item, err := storage.Get(sessionKeyPrefix + key)
+	if err != nil {
+		return nil, err
+	}
+	if item != nil {
+		if err = json.Unmarshal(item.Value, &session.values); err != nil {
+			return nil, fmt.Errorf("failed to parse session: %w", err)
+		}
+		session.version = item.Version
+	}
+	session.loaded = copySessionValues(session.values)
+
+	return session, nil
+}
+
+// Save a session to storage, merging its changes into the latest values on conflicts.
+func saveSession(storage Storage, session *Session, ttl time.Duration) (err error) {
+	var version uint64
+	for i := 0; i < maxSessionSaveRetries; i++ {
+		var bytes []byte
+		if bytes, err = json.Marshal(session.values); err != nil {
+			return fmt.Errorf("failed to serialize session: %w", err)
+		}
+
+		if version, err = storage.CompareAndSwap(sessionKeyPrefix+session.Key, session.version, bytes, ttl); err != ErrStorageConflict {
+			break
+		}
+
+		var latest *Session
+		if latest, err = loadSession(storage, session.Key); err != nil {
+			return err
+		}
+		session.merge(latest)
+	}
+	if err != nil {
+		return err
+	}
+	session.version, session.changed = version, false
+	session.loaded = copySessionValues(session.values)
+
+	return nil
+}
+
+// Apply the changes of this session (since loaded) to the values of given latest one, and take them.
+func (s *Session) merge(latest *Session) {
+	values := copySessionValues(latest.values)
+	for key, value := range s.values {
+		if loaded, exists := s.loaded[key]; !exists || loaded != value {
+			values[key] = value
+		}
+	}
+	for key := range s.loaded {
+		if _, exists := s.values[key]; !exists {
+			delete(values, key)
+		}
+	}
+
+	s.values, s.loaded, s.version = values, latest.loaded, latest.version
+}
+
+// Copy values of a session.
+func copySessionValues(values map[string]string) map[string]string {
+	copied := map[string]string{}
+	for key, value := range values {
+		copied[key] = value
+	}
+	return copied
+}
+
+// Get the key of a session for given update and scope.
+func sessionKey(update Update, scope SessionScope) (key string, ok bool) {
+	chat, from := update.GetChat(), update.GetFrom()
+
+	switch scope {
+	case SessionScopeChat:
+		if chat != nil {
+			return fmt.Sprintf("chat:%d", chat.ID), true
+		}
+	case SessionScopeUser:
+		if from != nil {
+			return fmt.Sprintf("user:%d", from.ID), true
+		}
+	case SessionScopeChatUser:
+		if chat != nil && from != nil {
+			return fmt.Sprintf("chat_user:%d:%d", chat.ID, from.ID), true
+		}
+	}
+
+	return "", false
+}
@@ -0,0 +1,554 @@
+package telegrambot
+
+// Key-value storages for sessions and other data of bots
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	storageFilePermission = 0600
+
+	// log of FileStorage is compacted when it has more records than this, and twice more than live items
+	minRecordsForCompaction = 1000
+)
+
+// ErrStorageConflict is returned when the version given for compare-and-swap does not match
+var ErrStorageConflict = errors.New("storage: version conflict")
+
+// StorageItem is a struct of an item in Storage
+type StorageItem struct {
+	Value     []byte    `json:"value"`
+	Version   uint64    `json:"version"`              // increases on every change
+	ExpiresAt time.Time `json:"expires_at,omitempty"` // zero for no expiry
+}
+
+// Check if the item is expired at given time.
+func (i StorageItem) expired(now time.Time) bool {
+	return !i.ExpiresAt.IsZero() && !now.Before(i.ExpiresAt)
+}
+
+// Storage is an interface of key-value storages
+type Storage interface {
+	// Get returns the item for given key. (nil if not exists or expired)
+	Get(key string) (*StorageItem, error)
+
+	// Set sets the value for given key, and returns its new version. (ttl = 0 for no expiry)
+	Set(key string, value []byte, ttl time.Duration) (version uint64, err error)
+
+	// CompareAndSwap sets the value for given key only when its current version equals given one,
+	// and returns its new version. (version = 0 when the key should not exist)
+	//
+	// ErrStorageConflict is returned when the version does not match.
+	CompareAndSwap(key string, version uint64, value []byte, ttl time.Duration) (newVersion uint64, err error)
+
+	// Delete deletes the item for given key.
+	Delete(key string) error
+
+	// List returns the items whose keys start with given prefix.
+	List(prefix string) (map[string]StorageItem, error)
+
+	// Close closes the storage.
+	Close() error
+}
+
+// MemoryStorage is a Storage which keeps items in memory
+type MemoryStorage struct {
+	sync.Mutex
+
+	items   map[string]StorageItem
+	version uint64
+}
+
+// NewMemoryStorage generates a new MemoryStorage.
+func NewMemoryStorage() *MemoryStorage {
+	return &MemoryStorage{
+		items: map[string]StorageItem{},
+	}
+}
+
+// Get returns the item for given key. (nil if not exists or expired)
+func (s *MemoryStorage) Get(key string) (*StorageItem, error) {
+	s.Lock()
+	defer s.Unlock()
+
+	if item, exists := s.get(key); exists {
+		return &item, nil
+	}
+	return nil, nil
+}
+
+// Set sets the value for given key, and returns its new version. (ttl = 0 for no expiry)
+func (s *MemoryStorage) Set(key string, value []byte, ttl time.Duration) (uint64, error) {
+	s.Lock()
+	defer s.Unlock()
+
+	return s.set(key, value, ttl).Version, nil
+}
+
+// CompareAndSwap sets the value for given key only when its current version equals given one.
+func (s *MemoryStorage) CompareAndSwap(key string, version uint64, value []byte, ttl time.Duration) (uint64, error) {
+	s.Lock()
+	defer s.Unlock()
+
+	if item, _ := s.get(key); item.Version != version {
+		return 0, ErrStorageConflict
+	}
+
+	return s.set(key, value, ttl).Version, nil
+}
+
+// Delete deletes the item for given key.
+func (s *MemoryStorage) Delete(key string) error {
+	s.Lock()
+	defer s.Unlock()
+
+	delete(s.items, key)
+
+	return nil
+}
+
+// List returns the items whose keys start with given prefix.
+func (s *MemoryStorage) List(prefix string) (map[string]StorageItem, error) {
+	s.Lock()
+	defer s.Unlock()
+
+	now := time.Now()
+	items := map[string]StorageItem{}
+	for key, item := range s.items {
+		if item.expired(now) {
+			delete(s.items, key)
+		} else if strings.HasPrefix(key, prefix) {
+			items[key] = copyStorageItem(item)
+		}
+	}
+
+	return items, nil
+}
+
+// Close does nothing for MemoryStorage.
+func (s *MemoryStorage) Close() error {
+	return nil
+}
+
+// Get an item which is not expired. (lock should be held)
+func (s *MemoryStorage) get(key string) (StorageItem, bool) {
+	item, exists := s.items[key]
+	if !exists {
+		return StorageItem{}, false
+	}
+	if item.expired(time.Now()) {
+		delete(s.items, key)
+		return StorageItem{}, false
+	}
+	return copyStorageItem(item), true
+}
+
+// Set an item with a new version. (lock should be held)
+func (s *MemoryStorage) set(key string, value []byte, ttl time.Duration) StorageItem {
+	item := s.next(value, ttl)
+	s.put(key, item)
+
+	return copyStorageItem(item)
+}
+
+// Generate an item with the next version, without setting it. (lock should be held)
+func (s *MemoryStorage) next(value []byte, ttl time.Duration) StorageItem {
+	item := StorageItem{
+		Value:   append([]byte(nil), value...),
+		Version: s.version + 1,
+	}
+	if ttl > 0 {
+		item.ExpiresAt = time.Now().Add(ttl)
+	}
+	return item
+}
+
+// Put an item as it is. (lock should be held)
+func (s *MemoryStorage) put(key string, item StorageItem) {
+	s.items[key] = item
+	if item.Version > s.version {
+		s.version = item.Version
+	}
+}
+
+// a record in the log of FileStorage
+type storageRecord struct {
+	Key     string       `json:"key"`
+	Deleted bool         `json:"deleted,omitempty"`
+	Item    *StorageItem `json:"item,omitempty"`
+	Version uint64       `json:"version,omitempty"` // last given version (in records without keys, written on compaction)
+}
+
+// FileStorage is a Storage which keeps items in memory and in a single append-only log file
+//
+// Every change is appended to the file and synced, so items survive crashes and restarts.
+// The file is compacted when it grows much larger than the live items.
+//
+// The last given version is kept through compactions, so versions are not reused (for compare-and-swap) even after restarts.
+type FileStorage struct {
+	memory   *MemoryStorage
+	filepath string
+
+	sync.Mutex
+	file    *os.File
+	records int // number of records in the log file
+}
+
+// NewFileStorage opens (or creates) a FileStorage with given file.
+//
+// A partially written record at the end of the file (from a crash) is ignored.
+func NewFileStorage(filepath string) (*FileStorage, error) {
+	s := &FileStorage{
+		memory:   NewMemoryStorage(),
+		filepath: filepath,
+	}
+
+	if err := s.replay(); err != nil {
+		return nil, err
+	}
+
+	var err error
+	if s.file, err = os.OpenFile(filepath, os.O_WRONLY|os.O_CREATE|os.O_APPEND, storageFilePermission); err != nil {
+		return nil, fmt.Errorf("failed to open storage file: %w", err)
+	}
+
+	return s, nil
+}
+
+// Get returns the item for given key. (nil if not exists or expired)
+func (s *FileStorage) Get(key string) (*StorageItem, error) {
+	return s.memory.Get(key)
+}
+
+// Set sets the value for given key, and returns its new version. (ttl = 0 for no expiry)
+func (s *FileStorage) Set(key string, value []byte, ttl time.Duration) (uint64, error) {
+	s.Lock()
+	defer s.Unlock()
+
+	s.memory.Lock()
+	item := s.memory.next(value, ttl)
+	s.memory.Unlock()
+
+	return s.write(key, item)
+}
+
+// CompareAndSwap sets the value for given key only when its current version equals given one.
+func (s *FileStorage) CompareAndSwap(key string, version uint64, value []byte, ttl time.Duration) (uint64, error) {
+	s.Lock()
+	defer s.Unlock()
+
+	s.memory.Lock()
+	if current, _ := s.memory.get(key); current.Version != version {
+		s.memory.Unlock()
+		return 0, ErrStorageConflict
+	}
+	item := s.memory.next(value, ttl)
+	s.memory.Unlock()
+
+	return s.write(key, item)
+}
+
+// Delete deletes the item for given key.
+func (s *FileStorage) Delete(key string) error {
+	s.Lock()
+	defer s.Unlock()
+
+	if err := s.append(storageRecord{Key: key, Deleted: true}); err != nil {
+		return err
+	}
+	_ = s.memory.Delete(key)
+
+	s.compactIfNeeded()
+
+	return nil
+}
+
+// List returns the items whose keys start with given prefix.
+func (s *FileStorage) List(prefix string) (map[string]StorageItem, error) {
+	return s.memory.List(prefix)
+}
+
+// Compact rewrites the log file with live items only.
+func (s *FileStorage) Compact() error {
+	s.Lock()
+	defer s.Unlock()
+
+	return s.compact()
+}
+
+// Close closes the log file.
+func (s *FileStorage) Close() error {
+	s.Lock()
+	defer s.Unlock()
+
+	if s.file == nil {
+		return nil
+	}
+
+	err := s.file.Close()
+	s.file = nil
+
+	return err
+}
+
+// Read the log file and apply its records to memory.
+func (s *FileStorage) replay() error {
+	file, err := os.Open(s.filepath)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return fmt.Errorf("failed to open storage file: %w", err)
+	}
+	defer file.Close()
+
+	reader := bufio.NewReader(file)
+	var offset int64 // end of the last complete record
+	for {
+		line, err := reader.ReadBytes('\n')
+		if err == io.EOF {
+			if len(line) > 0 {
+				// truncate partially written record from a crash, for appending new ones correctly
+				if err := os.Truncate(s.filepath, offset); err != nil {
+					return fmt.Errorf("failed to truncate partial record of storage file: %w", err)
+				}
+			}
+			break
+		} else if err != nil {
+			return fmt.Errorf("failed to read storage file: %w", err)
+		}
+		offset += int64(len(line))
+
+		var record storageRecord
+		if err := json.Unmarshal(line, &record); err != nil {
+			return fmt.Errorf("broken record in storage file: %w", err)
+		}
+		s.records++
+
+		if record.Key == "" {
+			if record.Version > s.memory.version {
+				s.memory.version = record.Version
+			}
+		} else if record.Deleted || record.Item == nil {
+			delete(s.memory.items, record.Key)
+		} else {
+			s.memory.items[record.Key] = *record.Item
+			if record.Item.Version > s.memory.version {
+				s.memory.version = record.Item.Version
+			}
+		}
+	}
+
+	return nil
+}
+
+// Append an item to the log file, then put it in memory. (lock should be held)
+//
+// Memory is not changed when appending fails.
+func (s *FileStorage) write(key string, item StorageItem) (uint64, error) {
+	if err := s.append(storageRecord{Key: key, Item: &item}); err != nil {
+		return 0, err
+	}
+
+	s.memory.Lock()
+	s.memory.put(key, item)
+	s.memory.Unlock()
+
+	s.compactIfNeeded()
+
+	return item.Version, nil
+}
+
+// Append a record to the log file. (lock should be held)
+func (s *FileStorage) append(record storageRecord) error {
+	if s.file == nil {
+		return fmt.Errorf("storage file is already closed: %s", s.filepath)
+	}
+
+	line, err := json.Marshal(record)
+	if err != nil {
+		return fmt.Errorf("failed to serialize storage record: %w", err)
+	}
+
+	if _, err = s.file.Write(append(line, '\n')); err != nil {
+		return fmt.Errorf("failed to write storage file: %w", err)
+	}
+	if err = s.file.Sync(); err != nil {
+		return fmt.Errorf("failed to sync storage file: %w", err)
+	}
+	s.records++
+
+	return nil
+}
+
+// Compact the log file if it has too many records. (lock should be held)
+//
+// Errors are ignored, as the log file is kept as it is on failures, and compaction will be retried on next changes.
+func (s *FileStorage) compactIfNeeded() {
+	s.memory.Lock()
+	live := len(s.memory.items)
+	s.memory.Unlock()
+
+	if s.records > minRecordsForCompaction && s.records > live*2 {
+		_ = s.compact()
+	}
+}
+
+// Rewrite the log file with live items, through a temporary file. (lock should be held)
+func (s *FileStorage) compact() error {
+	if s.file == nil {
+		return fmt.Errorf("storage file is already closed: %s", s.filepath)
+	}
+
+	items, _ := s.memory.List("")
+
+	s.memory.Lock()
+	version := s.memory.version
+	s.memory.Unlock()
+
+	// opened for appending, so it can replace the current file handle after the rename
+	tmp, err := os.OpenFile(s.filepath+".compact", os.O_WRONLY|os.O_CREATE|os.O_TRUNC|os.O_APPEND, storageFilePermission)
+	if err != nil {
+		return fmt.Errorf("failed to create compacted storage file: %w", err)
+	}
+
+	// versions of deleted items are not in the compacted file, so the last given version is written first
+	writer := bufio.NewWriter(tmp)
+	var line []byte
+	if line, err = json.Marshal(storageRecord{Version: version}); err == nil {
+		_, err = writer.Write(append(line, '\n'))
+	}
+	for key, item := range items {
+		if err != nil {
+			break
+		}
+		item := item
+
+		if line, err = json.Marshal(storageRecord{Key: key, Item: &item}); err != nil {
+			break
+		}
+		if _, err = writer.Write(append(line, '\n')); err != nil {
+			break
+		}
+	}
+	if err == nil {
+		err = writer.Flush()
+	}
+	if err == nil {
+		err = tmp.Sync()
+	}
+	if err != nil {
+		_ = tmp.Close()
+		_ = os.Remove(tmp.Name())
+		return fmt.Errorf("failed to write compacted storage file: %w", err)
+	}
+
+	// the current file (and its handle) is kept until the compacted one replaces it
+	if err = os.Rename(tmp.Name(), s.filepath); err != nil {
+		_ = tmp.Close()
+		_ = os.Remove(tmp.Name())
+		return fmt.Errorf("failed to replace storage file: %w", err)
+	}
+	syncDir(filepath.Dir(s.filepath))
+
+	_ = s.file.Close()
+	s.file = tmp
+	s.records = len(items) + 1 // with the version record
+
+	return nil
+}
+
+// Sync a directory for persisting renames in it. (errors are ignored, as not all platforms support it)
+func syncDir(dir string) {
+	if d, err := os.Open(dir); err == nil {
+		_ = d.Sync()
+		_ = d.Close()
+	}
+}
+
+// Copy given item.
+func copyStorageItem(item StorageItem) StorageItem {
+	item.Value = append([]byte(nil), item.Value...)
+	return item
+}
+
+////////////////////////////////
+// ConversationStore with Storage
+//
+
+const (
+	conversationKeyPrefix = "conversation:"
+)
+
+// StorageConversationStore is a ConversationStore which saves states in a Storage
+type StorageConversationStore struct {
+	storage Storage
+}
+
+// NewStorageConversationStore generates a new ConversationStore which saves states in given storage.
+func NewStorageConversationStore(storage Storage) *StorageConversationStore {
+	return &StorageConversationStore{
+		storage: storage,
+	}
+}
+
+// LoadConversation returns the state for given key. (nil if not exists)
+func (s *StorageConversationStore) LoadConversation(key string) (*ConversationState, error) {
+	item, err := s.storage.Get(conversationKeyPrefix + key)
+	if err != nil || item == nil {
+		return nil, err
+	}
+
+	var state ConversationState
+	if err = json.Unmarshal(item.Value, &state); err != nil {
+		return nil, fmt.Errorf("failed to parse conversation state: %w", err)
+	}
+
+	return &state, nil
+}
+
+// SaveConversation saves the state for given key.
+func (s *StorageConversationStore) SaveConversation(key string, state ConversationState) error {
+	bytes, err := json.Marshal(state)
+	if err != nil {
+		return fmt.Errorf("failed to serialize conversation state: %w", err)
+	}
+
+	_, err = s.storage.Set(conversationKeyPrefix+key, bytes, 0)
+
+	return err
+}
+
+// DeleteConversation deletes the state for given key.
+func (s *StorageConversationStore) DeleteConversation(key string) error {
+	return s.storage.Delete(conversationKeyPrefix + key)
+}
+
+// ListConversations returns all saved states with their keys.
+func (s *StorageConversationStore) ListConversations() (map[string]ConversationState, error) {
+	items, err := s.storage.List(conversationKeyPrefix)
+	if err != nil {
+		return nil, err
+	}
+
+	states := map[string]ConversationState{}
+	for key, item := range items {
+		var state ConversationState
+		if err = json.Unmarshal(item.Value, &state); err != nil {
+			return nil, fmt.Errorf("failed to parse conversation state: %w", err)
+		}
+		states[strings.TrimPrefix(key, conversationKeyPrefix)] = state
+	}
+
+	return states, nil
+}
@@ -0,0 +1,268 @@
+package telegrambot
+
+// Throttling incoming updates per user and chat (anti-flood)
+
+import (
+	"fmt"
+	"sync"
+	"time"
+)
+
+const (
+	defaultThrottleSlowDownText    = "Slow down!"
+	defaultThrottleRestrictSeconds = 60
+	defaultThrottleWindowSeconds   = 1  // for limits without windows
+	minThrottleRestrictSeconds     = 30 // restrictions shorter than this are considered forever
+
+	throttlePruneInterval = time.Minute
+)
+
+// ThrottleAction is an action for throttled updates
+type ThrottleAction string
+
+// ThrottleAction strings
+const (
+	ThrottleActionDrop     ThrottleAction = "drop"     // drop silently
+	ThrottleActionAnswer   ThrottleAction = "answer"   // answer callback queries with a notification (others are dropped)
+	ThrottleActionRestrict ThrottleAction = "restrict" // restrict the user temporarily in groups (others are treated like ThrottleActionAnswer)
+)
+
+// ThrottleConfig is a struct of configurations for Throttler
+type ThrottleConfig struct {
+	// at most PerUserLimit updates from a user in PerUserWindowSeconds (0 for no limit, window default: 1)
+	PerUserLimit         int `json:"per_user_limit"`
+	PerUserWindowSeconds int `json:"per_user_window_seconds"`
+
+	// at most PerChatLimit updates in a chat in PerChatWindowSeconds (0 for no limit, window default: 1)
+	PerChatLimit         int `json:"per_chat_limit"`
+	PerChatWindowSeconds int `json:"per_chat_window_seconds"`
+
+	Action          ThrottleAction `json:"action"`           // default: ThrottleActionDrop
+	SlowDownText    string         `json:"slow_down_text"`   // for ThrottleActionAnswer (default: "Slow down!")
+	RestrictSeconds int            `json:"restrict_seconds"` // for ThrottleActionRestrict (default: 60)
+
+	ExemptUserIDs []int   `json:"exempt_user_ids"`
+	ExemptChatIDs []int64 `json:"exempt_chat_ids"`
+
+	// called when an update is throttled
+	OnThrottled func(b *Bot, update Update, reason string) `json:"-"`
+}
+
+// Throttler limits incoming updates per user and chat with sliding windows
+type Throttler struct {
+	config ThrottleConfig
+
+	sync.Mutex
+	users       map[int][]time.Time
+	chats       map[int64][]time.Time
+	restricted  map[string]time.Time // restricted users in chats, until
+	exemptUsers map[int]bool
+	exemptChats map[int64]bool
+	prunedAt    time.Time
+}
+
+// NewThrottler generates a new Throttler with given config.
+func NewThrottler(config ThrottleConfig) *Throttler {
+	if config.Action == "" {
+		config.Action = ThrottleActionDrop
+	}
+	if config.SlowDownText == "" {
+		config.SlowDownText = defaultThrottleSlowDownText
+	}
+	if config.RestrictSeconds < minThrottleRestrictSeconds {
+		config.RestrictSeconds = defaultThrottleRestrictSeconds
+	}
+	if config.PerUserLimit > 0 && config.PerUserWindowSeconds <= 0 {
+		config.PerUserWindowSeconds = defaultThrottleWindowSeconds
+	}
+	if config.PerChatLimit > 0 && config.PerChatWindowSeconds <= 0 {
+		config.PerChatWindowSeconds = defaultThrottleWindowSeconds
+	}
+
+	t := &Throttler{
+		config:      config,
+		users:       map[int][]time.Time{},
+		chats:       map[int64][]time.Time{},
+		restricted:  map[string]time.Time{},
+		exemptUsers: map[int]bool{},
+		exemptChats: map[int64]bool{},
+		prunedAt:    time.Now(),
+	}
+	for _, userID := range config.ExemptUserIDs {
+		t.exemptUsers[userID] = true
+	}
+	for _, chatID := range config.ExemptChatIDs {
+		t.exemptChats[chatID] = true
+	}
+
+	return t
+}
+
+// ExemptUser adds (or removes) given user to exempt list.
+func (t *Throttler) ExemptUser(userID int, exempt bool) {
+	t.Lock()
+	defer t.Unlock()
+
+	if exempt {
+		t.exemptUsers[userID] = true
+	} else {
+		delete(t.exemptUsers, userID)
+	}
+}
+
+// ExemptChat adds (or removes) given chat to exempt list.
+func (t *Throttler) ExemptChat(chatID int64, exempt bool) {
+	t.Lock()
+	defer t.Unlock()
+
+	if exempt {
+		t.exemptChats[chatID] = true
+	} else {
+		delete(t.exemptChats, chatID)
+	}
+}
+
+// Allow records given update, and checks if it is allowed. (reason is given when not allowed)
+func (t *Throttler) Allow(update Update) (allowed bool, reason string) {
+	chat, from := update.GetChat(), update.GetFrom()
+	now := time.Now()
+
+	t.Lock()
+	defer t.Unlock()
+
+	if now.Sub(t.prunedAt) > throttlePruneInterval {
+		t.prune(now)
+	}
+
+	if (from != nil && t.exemptUsers[from.ID]) || (chat != nil && t.exemptChats[chat.ID]) {
+		return true, ""
+	}
+
+	// every update is recorded, even if throttled, so that flooding keeps being throttled
+	if from != nil && t.config.PerUserLimit > 0 {
+		timestamps := t.users[from.ID]
+		if !recordTimestamps(&timestamps, now, t.config.PerUserLimit, t.config.PerUserWindowSeconds) {
+			reason = fmt.Sprintf("user %d exceeded %d updates in %d seconds", from.ID, t.config.PerUserLimit, t.config.PerUserWindowSeconds)
+		}
+		t.users[from.ID] = timestamps
+	}
+	if chat != nil && t.config.PerChatLimit > 0 {
+		timestamps := t.chats[chat.ID]
+		if !recordTimestamps(&timestamps, now, t.config.PerChatLimit, t.config.PerChatWindowSeconds) && reason == "" {
+			reason = fmt.Sprintf("chat %d exceeded %d updates in %d seconds", chat.ID, t.config.PerChatLimit, t.config.PerChatWindowSeconds)
+		}
+		t.chats[chat.ID] = timestamps
+	}
+
+	return reason == "", reason
+}
+
+// Middleware returns a middleware which passes only the allowed updates, and takes action for throttled ones.
+func (t *Throttler) Middleware() Middleware {
+	return func(next Handler) Handler {
+		return HandlerFunc(func(ctx *UpdateContext) {
+			if ctx.Err != nil {
+				next.HandleUpdate(ctx)
+				return
+			}
+
+			if allowed, reason := t.Allow(ctx.Update); allowed {
+				next.HandleUpdate(ctx)
+			} else {
+				t.throttled(ctx.Bot, ctx.Update, reason)
+			}
+		})
+	}
+}
+
+// Take action for a throttled update.
+func (t *Throttler) throttled(b *Bot, update Update, reason string) {
+	b.verbose("throttled update #%d: %s", update.UpdateID, reason)
+
+	if t.config.OnThrottled != nil {
+		t.config.OnThrottled(b, update, reason)
+	}
+
+	switch t.config.Action {
+	case ThrottleActionRestrict:
+		if t.restrict(b, update) && !update.HasCallbackQuery() {
+			return
+		}
+		fallthrough // callback queries should be answered even when restricted
+	case ThrottleActionAnswer:
+		if update.HasCallbackQuery() {
+			if answered := b.AnswerCallbackQuery(update.CallbackQuery.ID, OptionsAnswerCallbackQuery{}.SetText(t.config.SlowDownText)); !answered.Ok {
+				b.error("failed to answer throttled callback query: %s", descriptionOf(answered.APIResponseBase))
+			}
+		}
+	}
+}
+
+// Restrict the sender of given update in its group temporarily, and return true if it was a group.
+func (t *Throttler) restrict(b *Bot, update Update) bool {
+	chat, from := update.GetChat(), update.GetFrom()
+	if chat == nil || from == nil || (chat.Type != ChatTypeGroup && chat.Type != ChatTypeSupergroup) {
+		return false
+	}
+
+	now := time.Now()
+	key := fmt.Sprintf("%d:%d", chat.ID, from.ID)
+
+	t.Lock()
+	if until, exists := t.restricted[key]; exists && now.Before(until) {
+		t.Unlock()
+		return true // already restricted
+	}
+	until := now.Add(time.Duration(t.config.RestrictSeconds) * time.Second)
+	t.restricted[key] = until
+	t.Unlock()
+
+	if restricted := b.RestrictChatMember(chat.ID, from.ID, ChatPermissions{}, OptionsRestrictChatMember{}.SetUntilDate(int(until.Unix()))); !restricted.Ok {
+		b.error("failed to restrict flooding user %d in chat %d: %s", from.ID, chat.ID, descriptionOf(restricted.APIResponseBase))
+	}
+
+	return true
+}
+
+// Remove expired records. (lock should be held)
+func (t *Throttler) prune(now time.Time) {
+	for userID, timestamps := range t.users {
+		if len(timestamps) == 0 || now.Sub(timestamps[len(timestamps)-1]) > time.Duration(t.config.PerUserWindowSeconds)*time.Second {
+			delete(t.users, userID)
+		}
+	}
+	for chatID, timestamps := range t.chats {
+		if len(timestamps) == 0 || now.Sub(timestamps[len(timestamps)-1]) > time.Duration(t.config.PerChatWindowSeconds)*time.Second {
+			delete(t.chats, chatID)
+		}
+	}
+	for key, until := range t.restricted {
+		if !now.Before(until) {
+			delete(t.restricted, key)
+		}
+	}
+
+	t.prunedAt = now
+}
+
+// Record a timestamp in a sliding window (keeping at most limit timestamps), and check if it is within the limit.
+func recordTimestamps(timestamps *[]time.Time, now time.Time, limit, windowSeconds int) bool {
+	windowStart := now.Add(-time.Duration(windowSeconds) * time.Second)
+
+	kept := (*timestamps)[:0]
+	for _, timestamp := range *timestamps {
+		if timestamp.After(windowStart) {
+			kept = append(kept, timestamp)
+		}
+	}
+
+	allowed := len(kept) < limit
+
+	kept = append(kept, now)
+	if len(kept) > limit {
+		kept = kept[len(kept)-limit:]
+	}
+	*timestamps = kept
+
+	return allowed
+}
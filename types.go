@@ -11,9 +11,10 @@ type ChatType string
 
 // ChatType strings
 const (
-	ChatTypePrivate ChatType = "private"
-	ChatTypeGroup   ChatType = "group"
-	ChatTypeChannel ChatType = "channel"
+	ChatTypePrivate    ChatType = "private"
+	ChatTypeGroup      ChatType = "group"
+	ChatTypeSupergroup ChatType = "supergroup"
+	ChatTypeChannel    ChatType = "channel"
 )
 
 // ParseMode is a mode of parse
@@ -235,7 +236,7 @@ type APIResponseMessageOrBool struct {
 // APIResponsePoll is an API response with result type: Poll
 type APIResponsePoll struct {
 	APIResponseBase
-	Result *Poll `json:"poll,omitempty"`
+	Result *Poll `json:"result,omitempty"`
 }
 
 // UpdateType is a type of updates (for allowed_updates)
@@ -353,8 +354,8 @@ const (
 // https://core.telegram.org/bots/api#inputmedia
 type InputMedia struct {
 	Type              InputMediaType `json:"type"`
-	Media             string         `json:"media"`
-	Thumb             InputFile      `json:"thumb,omitempty"` // video, animation, audio, document
+	Media             InputFile      `json:"media"`           // file id, url, or a new file to upload (as 'attach://<name>')
+	Thumb             *InputFile     `json:"thumb,omitempty"` // video, animation, audio, document (new file only)
 	Caption           string         `json:"caption,omitempty"`
 	ParseMode         ParseMode      `json:"parse_mode,omitempty"`
 	Width             int            `json:"width,omitempty"`              // video, animation
@@ -363,6 +364,10 @@ type InputMedia struct {
 	Performer         string         `json:"performer,omitempty"`          // audio only
 	Title             string         `json:"title,omitempty"`              // audio only
 	SupportsStreaming bool           `json:"supports_streaming,omitempty"` // video only
+
+	// names of multipart parts for new files (set when requested)
+	mediaAttachName string
+	thumbAttachName string
 }
 
 // InputFile represents contents of a file to be uploaded.
@@ -731,6 +736,7 @@ type Message struct {
 	ForwardDate           int                `json:"forward_date,omitempty"`
 	ReplyToMessage        *Message           `json:"reply_to_message,omitempty"`
 	EditDate              int                `json:"edit_date,omitempty"`
+	MediaGroupID          *string            `json:"media_group_id,omitempty"`
 	AuthorSignature       *string            `json:"author_signature,omitempty"`
 	Text                  *string            `json:"text,omitempty"`
 	Entities              []MessageEntity    `json:"entities,omitempty"`
@@ -5,6 +5,7 @@ import (
 	"encoding/json"
 	"fmt"
 	"io"
+	"unicode/utf16"
 )
 
 ////////////////////////////////
@@ -429,6 +430,53 @@ func (u *Update) HasPoll() bool {
 	return u.Poll != nil
 }
 
+// GetMessage returns the message of Update.
+//
+// (one of message, edited message, channel post, edited channel post, or message of callback query)
+func (u *Update) GetMessage() *Message {
+	switch {
+	case u.Message != nil:
+		return u.Message
+	case u.EditedMessage != nil:
+		return u.EditedMessage
+	case u.ChannelPost != nil:
+		return u.ChannelPost
+	case u.EditedChannelPost != nil:
+		return u.EditedChannelPost
+	case u.CallbackQuery != nil:
+		return u.CallbackQuery.Message
+	}
+	return nil
+}
+
+// GetFrom returns the sender of Update.
+func (u *Update) GetFrom() *User {
+	switch {
+	case u.CallbackQuery != nil:
+		return &u.CallbackQuery.From
+	case u.InlineQuery != nil:
+		return &u.InlineQuery.From
+	case u.ChosenInlineResult != nil:
+		return &u.ChosenInlineResult.From
+	case u.ShippingQuery != nil:
+		return &u.ShippingQuery.From
+	case u.PreCheckoutQuery != nil:
+		return &u.PreCheckoutQuery.From
+	}
+	if message := u.GetMessage(); message != nil {
+		return message.From
+	}
+	return nil
+}
+
+// GetChat returns the chat of Update.
+func (u *Update) GetChat() *Chat {
+	if message := u.GetMessage(); message != nil {
+		return &message.Chat
+	}
+	return nil
+}
+
 ////////////////////////////////
 // Helper functions for User
 //
@@ -486,6 +534,22 @@ func (m *Message) HasMessageEntities() bool {
 	return len(m.Entities) > 0
 }
 
+// EntityText returns the part of Text which is covered by given MessageEntity.
+//
+// (offset and length of MessageEntity are in UTF-16 code units)
+func (m *Message) EntityText(entity MessageEntity) string {
+	if m.Text == nil {
+		return ""
+	}
+
+	encoded := utf16.Encode([]rune(*m.Text))
+	if entity.Offset < 0 || entity.Length < 0 || entity.Offset+entity.Length > len(encoded) {
+		return ""
+	}
+
+	return string(utf16.Decode(encoded[entity.Offset : entity.Offset+entity.Length]))
+}
+
 // HasAudio checks if Message has Audio.
 func (m *Message) HasAudio() bool {
 	return m.Audio != nil
@@ -658,6 +722,8 @@ func NewKeyboardButtons(texts ...string) []KeyboardButton {
 
 // NewInlineKeyboardButtonsWithURL is a helper function
 // for generating an array of InlineKeyboardButtons with urls
+//
+// Deprecated: order of buttons is random (map iteration), use InlineKeyboardBuilder instead.
 func NewInlineKeyboardButtonsWithURL(values map[string]string) []InlineKeyboardButton {
 	keyboards := []InlineKeyboardButton{}
 
@@ -674,12 +740,16 @@ func NewInlineKeyboardButtonsWithURL(values map[string]string) []InlineKeyboardB
 
 // NewInlineKeyboardButtonsWithCallbackData is a helper function
 // for generating an array of InlineKeyboardButtons with callback data
+//
+// Deprecated: order of buttons is random (map iteration), use InlineKeyboardBuilder instead.
 func NewInlineKeyboardButtonsWithCallbackData(values map[string]string) []InlineKeyboardButton {
 	return NewInlineKeyboardButtonsAsColumnsWithCallbackData(values)
 }
 
 // NewInlineKeyboardButtonsAsColumnsWithCallbackData is a helper function
 // for generating an array of InlineKeyboardButtons (as columns) with callback data
+//
+// Deprecated: order of buttons is random (map iteration), use InlineKeyboardBuilder instead.
 func NewInlineKeyboardButtonsAsColumnsWithCallbackData(values map[string]string) []InlineKeyboardButton {
 	keyboards := []InlineKeyboardButton{}
 
@@ -696,6 +766,8 @@ func NewInlineKeyboardButtonsAsColumnsWithCallbackData(values map[string]string)
 
 // NewInlineKeyboardButtonsAsRowsWithCallbackData is a helper function
 // for generating an array of InlineKeyboardButtons (as rows) with callback data
+//
+// Deprecated: order of buttons is random (map iteration), use InlineKeyboardBuilder instead.
 func NewInlineKeyboardButtonsAsRowsWithCallbackData(values map[string]string) [][]InlineKeyboardButton {
 	keyboards := [][]InlineKeyboardButton{}
 
@@ -712,8 +784,32 @@ func NewInlineKeyboardButtonsAsRowsWithCallbackData(values map[string]string) []
 	return keyboards
 }
 
+// EncodedCallbackButton is a pair of a button's text and its callback payload, for NewInlineKeyboardButtonsWithEncodedCallbackData
+type EncodedCallbackButton struct {
+	Text    string
+	Payload interface{} // encoded by CallbackCodec (can be nil)
+}
+
+// NewInlineKeyboardButtonsWithEncodedCallbackData is a helper function
+// for generating an array of InlineKeyboardButtons with callback data encoded by given codec (in the order of given buttons)
+func NewInlineKeyboardButtonsWithEncodedCallbackData(codec *CallbackCodec, kind string, buttons []EncodedCallbackButton) ([]InlineKeyboardButton, error) {
+	keyboards := []InlineKeyboardButton{}
+
+	for _, b := range buttons {
+		button, err := codec.InlineKeyboardButton(b.Text, kind, b.Payload)
+		if err != nil {
+			return nil, err
+		}
+		keyboards = append(keyboards, button)
+	}
+
+	return keyboards, nil
+}
+
 // NewInlineKeyboardButtonsWithSwitchInlineQuery is a helper function
 // for generating an array of InlineKeyboardButtons with switch inline query
+//
+// Deprecated: order of buttons is random (map iteration), use InlineKeyboardBuilder instead.
 func NewInlineKeyboardButtonsWithSwitchInlineQuery(values map[string]string) []InlineKeyboardButton {
 	keyboards := []InlineKeyboardButton{}
 
@@ -777,3 +873,18 @@ func InputFileFromFileID(fileID string) InputFile {
 		FileID: &fileID,
 	}
 }
+
+// NewInputMedia generates an InputMedia with given type and media
+func NewInputMedia(mediaType InputMediaType, media InputFile) InputMedia {
+	return InputMedia{
+		Type:  mediaType,
+		Media: media,
+	}
+}
+
+// NewInputMediaFromFileID generates an InputMedia with given type and file id
+//
+// Given string is sent as it is, so it can also be an url. (same as the former string InputMedia.Media)
+func NewInputMediaFromFileID(mediaType InputMediaType, fileID string) InputMedia {
+	return NewInputMedia(mediaType, InputFileFromFileID(fileID))
+}
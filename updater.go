@@ -0,0 +1,279 @@
+package telegrambot
+
+// Updater for receiving updates through polling or webhook
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// UpdaterMode is a mode of Updater
+type UpdaterMode string
+
+// UpdaterMode strings
+const (
+	UpdaterModePolling UpdaterMode = "polling"
+	UpdaterModeWebhook UpdaterMode = "webhook"
+)
+
+// UpdaterConfig is a struct of configurations for Updater
+type UpdaterConfig struct {
+	Mode UpdaterMode `json:"mode"`
+
+	// for polling
+	PollingOffset   int `json:"polling_offset,omitempty"`
+	PollingInterval int `json:"polling_interval,omitempty"` // in seconds
+
+	// for webhook
+	WebhookHost    string       `json:"webhook_host,omitempty"`
+	WebhookPort    int          `json:"webhook_port,omitempty"`  // port number which the webhook server listens on
+	WebhookURL     string       `json:"webhook_url,omitempty"`   // public url of webhook (if it differs from the one built with host and port)
+	CertFilepath   string       `json:"cert_filepath,omitempty"` // uploaded as a self-signed certificate only when WebhookURL is not given
+	KeyFilepath    string       `json:"key_filepath,omitempty"`  // if certificate or private key is not given, webhook server will not serve TLS
+	MaxConnections int          `json:"max_connections,omitempty"`
+	AllowedUpdates []UpdateType `json:"allowed_updates,omitempty"`
+
+	DropPendingUpdates bool `json:"drop_pending_updates,omitempty"`
+}
+
+// Updater is an interface for receiving updates and feeding them to the update handler
+type Updater interface {
+	// Start starts receiving updates in background, and returns immediately.
+	//
+	// Webhook will be registered or deleted as needed.
+	Start(updateHandler func(b *Bot, update Update, err error)) error
+
+	// Stop stops receiving updates.
+	Stop() error
+
+	// Wait waits until the updater stops.
+	Wait() error
+}
+
+// NewUpdater generates a new Updater with given config.
+func (b *Bot) NewUpdater(config UpdaterConfig) (Updater, error) {
+	switch config.Mode {
+	case UpdaterModePolling:
+		if config.PollingInterval <= 0 {
+			config.PollingInterval = 1
+		}
+
+		return &pollingUpdater{
+			b:      b,
+			config: config,
+		}, nil
+	case UpdaterModeWebhook:
+		if config.WebhookPort <= 0 {
+			return nil, fmt.Errorf("webhook port should be given")
+		}
+		if config.WebhookHost == "" && config.WebhookURL == "" {
+			return nil, fmt.Errorf("webhook host or url should be given")
+		}
+		if config.MaxConnections <= 0 {
+			config.MaxConnections = 40
+		}
+
+		return &webhookUpdater{
+			b:      b,
+			config: config,
+		}, nil
+	}
+
+	return nil, fmt.Errorf("unsupported updater mode: '%s'", config.Mode)
+}
+
+// Updater which polls updates with GetUpdates
+type pollingUpdater struct {
+	b      *Bot
+	config UpdaterConfig
+
+	sync.Mutex
+	done chan struct{}
+}
+
+// Start deletes webhook and starts polling updates.
+func (u *pollingUpdater) Start(updateHandler func(b *Bot, update Update, err error)) error {
+	u.Lock()
+	defer u.Unlock()
+
+	if u.done != nil {
+		return fmt.Errorf("updater is already started")
+	}
+	if updateHandler == nil {
+		return fmt.Errorf("given update handler is nil")
+	}
+
+	// getUpdates does not work while webhook is registered
+	if unhooked := u.b.DeleteWebhook(OptionsDeleteWebhook{}.SetDropPendingUpdates(u.config.DropPendingUpdates)); !unhooked.Ok {
+		return fmt.Errorf("failed to delete webhook: %s", descriptionOf(unhooked.APIResponseBase))
+	}
+
+	done := make(chan struct{})
+	u.done = done
+
+	go func() {
+		u.b.StartMonitoringUpdates(u.config.PollingOffset, u.config.PollingInterval, updateHandler)
+
+		close(done)
+	}()
+
+	return nil
+}
+
+// Stop stops polling updates.
+func (u *pollingUpdater) Stop() error {
+	u.Lock()
+	defer u.Unlock()
+
+	if u.done == nil {
+		return fmt.Errorf("updater is not started")
+	}
+
+	u.b.StopMonitoringUpdates()
+	<-u.done
+
+	u.done = nil
+
+	return nil
+}
+
+// Wait waits until polling stops.
+func (u *pollingUpdater) Wait() error {
+	u.Lock()
+	done := u.done
+	u.Unlock()
+
+	if done != nil {
+		<-done
+	}
+
+	return nil
+}
+
+// Updater which receives updates through webhook
+type webhookUpdater struct {
+	b      *Bot
+	config UpdaterConfig
+
+	sync.Mutex
+	server *http.Server
+	done   chan struct{}
+	err    error
+}
+
+// Start registers webhook and starts a webhook server.
+func (u *webhookUpdater) Start(updateHandler func(b *Bot, update Update, err error)) error {
+	u.Lock()
+	defer u.Unlock()
+
+	if u.done != nil {
+		return fmt.Errorf("updater is already started")
+	}
+	if updateHandler == nil {
+		return fmt.Errorf("given update handler is nil")
+	}
+
+	if hooked := u.setWebhook(); !hooked.Ok {
+		return fmt.Errorf("failed to set webhook: %s", descriptionOf(hooked.APIResponseBase))
+	}
+	u.b.webhookPort = u.config.WebhookPort
+
+	u.b.verbose("starting webhook server on: %s (port: %d) ...", u.b.getWebhookPath(), u.b.webhookPort)
+
+	server := u.b.newWebhookServer(u.b.WebhookHandler(updateHandler))
+	done := make(chan struct{})
+	u.server, u.done, u.err = server, done, nil
+
+	go func() {
+		var err error
+		if u.config.CertFilepath != "" && u.config.KeyFilepath != "" {
+			err = server.ListenAndServeTLS(u.config.CertFilepath, u.config.KeyFilepath)
+		} else {
+			err = server.ListenAndServe() // behind a TLS-terminating proxy
+		}
+
+		if err != nil && err != http.ErrServerClosed {
+			u.b.error("webhook server stopped with error: %s", err)
+
+			u.Lock()
+			u.err = err
+			u.Unlock()
+		}
+
+		close(done)
+	}()
+
+	return nil
+}
+
+// Register webhook with the configuration.
+func (u *webhookUpdater) setWebhook() APIResponseBool {
+	options := OptionsSetWebhook{}.
+		SetMaxConnections(u.config.MaxConnections).
+		SetAllowedUpdates(u.config.AllowedUpdates).
+		SetDropPendingUpdates(u.config.DropPendingUpdates)
+
+	if u.config.WebhookURL != "" {
+		return u.b.SetWebhookWithURL(u.config.WebhookURL, options)
+	}
+
+	u.b.webhookHost = u.config.WebhookHost
+	u.b.webhookPort = u.config.WebhookPort
+	if u.config.CertFilepath != "" {
+		options.SetCertificate(u.config.CertFilepath)
+	}
+
+	return u.b.setWebhook(u.b.getWebhookURL(), options)
+}
+
+// Stop shuts down the webhook server gracefully.
+func (u *webhookUpdater) Stop() error {
+	u.Lock()
+	server, done := u.server, u.done
+	u.Unlock()
+
+	if server == nil {
+		return fmt.Errorf("updater is not started")
+	}
+
+	u.b.verbose("stopping webhook server...")
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	err := server.Shutdown(ctx)
+	<-done
+
+	u.Lock()
+	u.server, u.done = nil, nil
+	u.Unlock()
+
+	return err
+}
+
+// Wait waits until the webhook server stops.
+func (u *webhookUpdater) Wait() error {
+	u.Lock()
+	done := u.done
+	u.Unlock()
+
+	if done != nil {
+		<-done
+	}
+
+	u.Lock()
+	defer u.Unlock()
+
+	return u.err
+}
+
+// Get description string from given API response.
+func descriptionOf(res APIResponseBase) string {
+	if res.Description != nil {
+		return *res.Description
+	}
+	return "no description"
+}
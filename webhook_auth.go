@@ -0,0 +1,219 @@
+package telegrambot
+
+// Authentication of incoming webhook requests
+//
+// https://core.telegram.org/bots/api#setwebhook
+// https://core.telegram.org/bots/webhooks#the-short-version
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/hex"
+	"fmt"
+	"net"
+	"net/http"
+	"regexp"
+	"strings"
+)
+
+const (
+	secretTokenHeader  = "X-Telegram-Bot-Api-Secret-Token"
+	forwardedForHeader = "X-Forwarded-For"
+
+	maxSecretTokenLength = 256
+)
+
+// TelegramWebhookCIDRs is a list of IP ranges from which Telegram sends webhook requests
+//
+// https://core.telegram.org/bots/webhooks#the-short-version
+var TelegramWebhookCIDRs = []string{
+	"149.154.160.0/20",
+	"91.108.4.0/22",
+}
+
+var secretTokenRegexp = regexp.MustCompile(`^[A-Za-z0-9_-]+$`)
+
+// WebhookAuth is a struct of configurations for authenticating webhook requests
+type WebhookAuth struct {
+	// Sent as `secret_token` with setWebhook,
+	// and compared with the `X-Telegram-Bot-Api-Secret-Token` header of each webhook request.
+	//
+	// 1~256 characters, only A-Z, a-z, 0-9, _ and - are allowed.
+	SecretToken string
+
+	// If not empty, webhook requests from other IP ranges will be rejected. (eg. TelegramWebhookCIDRs)
+	AllowedCIDRs []string
+
+	// X-Forwarded-For header is honored only when the request comes from these IP ranges.
+	TrustedProxyCIDRs []string
+}
+
+// webhook authenticator built from WebhookAuth
+type webhookAuthenticator struct {
+	secretToken    string
+	allowedNets    []*net.IPNet
+	trustedProxies []*net.IPNet
+}
+
+// SetWebhookAuth sets configurations for authenticating webhook requests.
+//
+// It should be called before SetWebhook, for the secret token to be registered.
+func (b *Bot) SetWebhookAuth(auth WebhookAuth) (err error) {
+	if auth.SecretToken != "" {
+		if err = checkSecretToken(auth.SecretToken); err != nil {
+			return err
+		}
+	}
+
+	authenticator := webhookAuthenticator{
+		secretToken: auth.SecretToken,
+	}
+	if authenticator.allowedNets, err = parseCIDRs(auth.AllowedCIDRs); err != nil {
+		return err
+	}
+	if authenticator.trustedProxies, err = parseCIDRs(auth.TrustedProxyCIDRs); err != nil {
+		return err
+	}
+
+	b.webhookLock.Lock()
+	b.webhookAuth = authenticator
+	b.webhookLock.Unlock()
+
+	return nil
+}
+
+// Get the authenticator of webhook requests.
+func (b *Bot) getWebhookAuth() webhookAuthenticator {
+	b.webhookLock.RLock()
+	defer b.webhookLock.RUnlock()
+
+	return b.webhookAuth
+}
+
+// Set the secret token for authenticating webhook requests.
+func (b *Bot) setWebhookSecretToken(token string) {
+	b.webhookLock.Lock()
+	defer b.webhookLock.Unlock()
+
+	b.webhookAuth.secretToken = token
+}
+
+// Check if given secret token is valid.
+func checkSecretToken(token string) error {
+	if len(token) > maxSecretTokenLength || !secretTokenRegexp.MatchString(token) {
+		return fmt.Errorf("invalid secret token: only 1~%d characters of A-Z, a-z, 0-9, _ and - are allowed", maxSecretTokenLength)
+	}
+	return nil
+}
+
+// SetWebhookPath sets a custom path for webhook url.
+//
+// If not set, the default path generated with the hash of token will be used.
+func (b *Bot) SetWebhookPath(path string) {
+	if path != "" && !strings.HasPrefix(path, "/") {
+		path = "/" + path
+	}
+
+	b.webhookCustomPath = path
+}
+
+// SetRandomWebhookPath sets a randomly generated path for webhook url, and returns it.
+func (b *Bot) SetRandomWebhookPath() (path string, err error) {
+	var random string
+	if random, err = randomHex(32); err == nil {
+		path = fmt.Sprintf("%s/%s", webhookPath, random)
+
+		b.SetWebhookPath(path)
+	}
+
+	return path, err
+}
+
+// GenerateSecretToken generates a random string which can be used as a secret token of webhook.
+func GenerateSecretToken() (string, error) {
+	return randomHex(32)
+}
+
+// Check if given webhook request is authorized, and returns http status code for the failure.
+func (b *Bot) authorizeWebhook(req *http.Request) (statusCode int, err error) {
+	auth := b.getWebhookAuth()
+
+	if len(auth.allowedNets) > 0 {
+		ip := auth.clientIP(req)
+		if ip == nil || !containsIP(auth.allowedNets, ip) {
+			return http.StatusForbidden, fmt.Errorf("webhook request from disallowed address: %s", req.RemoteAddr)
+		}
+	}
+
+	if auth.secretToken != "" {
+		if subtle.ConstantTimeCompare([]byte(req.Header.Get(secretTokenHeader)), []byte(auth.secretToken)) != 1 {
+			return http.StatusUnauthorized, fmt.Errorf("webhook request with invalid secret token from: %s", req.RemoteAddr)
+		}
+	}
+
+	return http.StatusOK, nil
+}
+
+// Get the IP address of the client.
+//
+// X-Forwarded-For header is used only when the request comes from one of the trusted proxies.
+func (a webhookAuthenticator) clientIP(req *http.Request) net.IP {
+	host, _, err := net.SplitHostPort(req.RemoteAddr)
+	if err != nil {
+		host = req.RemoteAddr
+	}
+	ip := net.ParseIP(host)
+	if ip == nil || !containsIP(a.trustedProxies, ip) || len(req.Header[forwardedForHeader]) == 0 {
+		return ip
+	}
+
+	// walk through forwarded addresses from the nearest one, skipping trusted proxies
+	forwarded := strings.Split(strings.Join(req.Header[forwardedForHeader], ","), ",")
+	for i := len(forwarded) - 1; i >= 0; i-- {
+		addr := net.ParseIP(strings.TrimSpace(forwarded[i]))
+		if addr == nil {
+			return nil
+		}
+
+		ip = addr
+		if !containsIP(a.trustedProxies, ip) {
+			break
+		}
+	}
+
+	return ip
+}
+
+// Parse given CIDR strings.
+func parseCIDRs(cidrs []string) (nets []*net.IPNet, err error) {
+	for _, cidr := range cidrs {
+		var ipNet *net.IPNet
+		if _, ipNet, err = net.ParseCIDR(cidr); err != nil {
+			return nil, fmt.Errorf("invalid CIDR '%s': %w", cidr, err)
+		}
+		nets = append(nets, ipNet)
+	}
+
+	return nets, nil
+}
+
+// Check if any of given networks contains given IP address.
+func containsIP(nets []*net.IPNet, ip net.IP) bool {
+	for _, n := range nets {
+		if n.Contains(ip) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Generate a random hex string from given number of bytes.
+func randomHex(numBytes int) (string, error) {
+	bytes := make([]byte, numBytes)
+	if _, err := rand.Read(bytes); err != nil {
+		return "", err
+	}
+
+	return hex.EncodeToString(bytes), nil
+}
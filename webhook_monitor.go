@@ -0,0 +1,280 @@
+package telegrambot
+
+// Monitoring health of webhook with GetWebhookInfo
+//
+// https://core.telegram.org/bots/api#getwebhookinfo
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+)
+
+const (
+	defaultWebhookMonitorIntervalSeconds = 60
+)
+
+// WebhookMonitorConfig is a struct of configurations for WebhookMonitor
+type WebhookMonitorConfig struct {
+	IntervalSeconds int // default: 60
+
+	// If empty, the url which was set with SetWebhookXXX() will be expected.
+	ExpectedURL string
+
+	// Pending updates are considered as growing when the count increases and exceeds this threshold.
+	PendingUpdatesThreshold int
+
+	// If true, webhook will be registered again (with ReregisterOptions) when its url does not match the expected one.
+	//
+	// The certificate which was registered last is sent again, if ReregisterOptions has no certificate.
+	AutoReregister    bool
+	ReregisterOptions OptionsSetWebhook
+
+	// callbacks
+	OnPendingUpdatesGrowing func(b *Bot, info WebhookInfo, previousCount int)
+	OnNewError              func(b *Bot, info WebhookInfo)
+	OnURLMismatch           func(b *Bot, info WebhookInfo, expectedURL string)
+}
+
+// WebhookHealth is a struct of webhook's health which was checked by WebhookMonitor
+type WebhookHealth struct {
+	Healthy            bool      `json:"healthy"`
+	Problems           []string  `json:"problems,omitempty"`
+	CheckedAt          time.Time `json:"checked_at"`
+	URL                string    `json:"url"`
+	ExpectedURL        string    `json:"expected_url"`
+	PendingUpdateCount int       `json:"pending_update_count"`
+	LastErrorDate      int       `json:"last_error_date,omitempty"`
+	LastErrorMessage   string    `json:"last_error_message,omitempty"`
+	Reregistered       int       `json:"reregistered"` // number of re-registrations
+}
+
+// WebhookMonitor polls webhook info periodically and reports problems of webhook.
+//
+// It also can be served as a health check handler. (eg. on `/healthz`)
+type WebhookMonitor struct {
+	b      *Bot
+	config WebhookMonitorConfig
+
+	sync.Mutex
+	health        WebhookHealth
+	checked       bool
+	lastErrorDate int
+	quit, done    chan struct{}
+}
+
+// NewWebhookMonitor generates a new WebhookMonitor with given config.
+func (b *Bot) NewWebhookMonitor(config WebhookMonitorConfig) *WebhookMonitor {
+	if config.IntervalSeconds <= 0 {
+		config.IntervalSeconds = defaultWebhookMonitorIntervalSeconds
+	}
+
+	return &WebhookMonitor{
+		b:      b,
+		config: config,
+
+		lastErrorDate: int(time.Now().Unix()), // errors before monitoring are not new ones
+	}
+}
+
+// Start starts checking webhook info periodically in background.
+func (m *WebhookMonitor) Start() {
+	m.Lock()
+	defer m.Unlock()
+
+	if m.quit != nil {
+		return // already started
+	}
+
+	m.b.verbose("starting webhook monitor (interval seconds: %d) ...", m.config.IntervalSeconds)
+
+	quit, done := make(chan struct{}), make(chan struct{})
+	m.quit, m.done = quit, done
+
+	go func() {
+		defer close(done)
+
+		ticker := time.NewTicker(time.Duration(m.config.IntervalSeconds) * time.Second)
+		defer ticker.Stop()
+
+		m.Check()
+
+		for {
+			select {
+			case <-quit:
+				return
+			case <-ticker.C:
+				m.Check()
+			}
+		}
+	}()
+}
+
+// Stop stops checking webhook info.
+func (m *WebhookMonitor) Stop() {
+	m.Lock()
+	quit, done := m.quit, m.done
+	m.quit, m.done = nil, nil
+	m.Unlock()
+
+	if quit != nil {
+		m.b.verbose("stopping webhook monitor...")
+
+		close(quit)
+		<-done
+	}
+}
+
+// Health returns the result of the last check.
+func (m *WebhookMonitor) Health() WebhookHealth {
+	m.Lock()
+	defer m.Unlock()
+
+	return m.health
+}
+
+// Check checks webhook info immediately, fires callbacks, and returns the result.
+func (m *WebhookMonitor) Check() WebhookHealth {
+	m.Lock()
+	previous, checked, lastErrorDate := m.health, m.checked, m.lastErrorDate
+	m.Unlock()
+
+	health := WebhookHealth{
+		CheckedAt:    time.Now(),
+		ExpectedURL:  m.expectedURL(),
+		Reregistered: previous.Reregistered,
+	}
+
+	res := m.b.GetWebhookInfo()
+	if !res.Ok || res.Result == nil {
+		health.Problems = append(health.Problems, fmt.Sprintf("failed to get webhook info: %s", descriptionOf(res.APIResponseBase)))
+
+		// keep the last known values, for not comparing next counts with unknown ones
+		health.URL = previous.URL
+		health.PendingUpdateCount = previous.PendingUpdateCount
+
+		m.save(health, lastErrorDate, checked)
+
+		return health
+	}
+	info := *res.Result
+
+	if info.URL != nil {
+		health.URL = *info.URL
+	}
+	health.PendingUpdateCount = info.PendingUpdateCount
+	health.LastErrorDate = info.LastErrorDate
+	if info.LastErrorMessage != nil {
+		health.LastErrorMessage = *info.LastErrorMessage
+	}
+
+	// pending updates
+	if checked && info.PendingUpdateCount > previous.PendingUpdateCount && info.PendingUpdateCount > m.config.PendingUpdatesThreshold {
+		health.Problems = append(health.Problems, fmt.Sprintf("pending updates growing: %d => %d", previous.PendingUpdateCount, info.PendingUpdateCount))
+
+		if m.config.OnPendingUpdatesGrowing != nil {
+			m.config.OnPendingUpdatesGrowing(m.b, info, previous.PendingUpdateCount)
+		}
+	}
+
+	// new error
+	if info.LastErrorDate > lastErrorDate {
+		lastErrorDate = info.LastErrorDate
+
+		health.Problems = append(health.Problems, fmt.Sprintf("new webhook error: %s", health.LastErrorMessage))
+
+		if m.config.OnNewError != nil {
+			m.config.OnNewError(m.b, info)
+		}
+	}
+
+	// url mismatch
+	if health.ExpectedURL != "" && health.URL != health.ExpectedURL {
+		health.Problems = append(health.Problems, fmt.Sprintf("webhook url mismatch: '%s' (expected: '%s')", m.b.redact(health.URL), m.b.redact(health.ExpectedURL)))
+
+		if m.config.OnURLMismatch != nil {
+			m.config.OnURLMismatch(m.b, info, health.ExpectedURL)
+		}
+
+		if m.config.AutoReregister {
+			// (only the registration is updated, for not changing the path and host which are being served)
+			if hooked := m.b.setWebhook(health.ExpectedURL, m.reregisterOptions()); hooked.Ok {
+				m.b.verbose("re-registered webhook url")
+
+				health.Reregistered++
+			} else {
+				health.Problems = append(health.Problems, fmt.Sprintf("failed to re-register webhook: %s", descriptionOf(hooked.APIResponseBase)))
+			}
+		}
+	}
+
+	health.Healthy = len(health.Problems) == 0
+
+	m.save(health, lastErrorDate, true)
+
+	return health
+}
+
+// ServeHTTP responds with the result of the last check in JSON.
+//
+// Status code will be 503 if webhook is not healthy.
+func (m *WebhookMonitor) ServeHTTP(writer http.ResponseWriter, req *http.Request) {
+	health := m.Health()
+
+	statusCode := http.StatusOK
+	if !health.Healthy {
+		statusCode = http.StatusServiceUnavailable
+	}
+
+	bytes, err := json.Marshal(health)
+	if err != nil {
+		http.Error(writer, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	writer.Header().Set("Content-Type", "application/json")
+	writer.WriteHeader(statusCode)
+	if _, err = writer.Write(bytes); err != nil {
+		m.b.error("failed to write webhook health: %s", err)
+	}
+}
+
+// Save the result of a check. (checked = whether webhook info was ever retrieved)
+func (m *WebhookMonitor) save(health WebhookHealth, lastErrorDate int, checked bool) {
+	if !health.Healthy {
+		m.b.error("webhook is not healthy: %v", health.Problems)
+	}
+
+	m.Lock()
+	defer m.Unlock()
+
+	m.health, m.checked, m.lastErrorDate = health, checked, lastErrorDate
+}
+
+// Get the expected url of webhook.
+func (m *WebhookMonitor) expectedURL() string {
+	if m.config.ExpectedURL != "" {
+		return m.config.ExpectedURL
+	}
+
+	return m.b.getRegisteredWebhookURL()
+}
+
+// Copy options for re-registering webhook. (setWebhook modifies given options)
+//
+// The certificate which was registered last is carried over, if not given in the options.
+func (m *WebhookMonitor) reregisterOptions() OptionsSetWebhook {
+	options := OptionsSetWebhook{}
+	for key, value := range m.config.ReregisterOptions {
+		options[key] = value
+	}
+	if _, exists := options["certificate"]; !exists {
+		if cert := m.b.getRegisteredWebhookCert(); cert != nil {
+			options["certificate"] = *cert
+		}
+	}
+
+	return options
+}
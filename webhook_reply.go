@@ -0,0 +1,159 @@
+package telegrambot
+
+// Replying with a method call in the response of webhook requests
+//
+// https://core.telegram.org/bots/api#making-requests-when-getting-updates
+
+import (
+	"encoding/json"
+	"net/http"
+	"time"
+)
+
+const (
+	defaultWebhookReplyTimeoutSeconds = 5
+)
+
+// WebhookReply is a method call which will be sent back in the response of a webhook request
+type WebhookReply struct {
+	Method string
+	Params map[string]interface{}
+}
+
+// NewWebhookReply generates a new WebhookReply with given method name and params.
+func NewWebhookReply(method string, params map[string]interface{}) *WebhookReply {
+	if params == nil {
+		params = map[string]interface{}{}
+	}
+
+	return &WebhookReply{
+		Method: method,
+		Params: params,
+	}
+}
+
+// NewWebhookReplySendMessage generates a new WebhookReply for sending a message.
+//
+// https://core.telegram.org/bots/api#sendmessage
+func NewWebhookReplySendMessage(chatID ChatID, text string, options OptionsSendMessage) *WebhookReply {
+	if options == nil {
+		options = map[string]interface{}{}
+	}
+
+	// essential params
+	options["chat_id"] = chatID
+	options["text"] = text
+
+	return NewWebhookReply("sendMessage", options)
+}
+
+// WebhookHandlerWithReply returns a http.Handler which receives webhooks and passes them to given webhookHandler function.
+//
+// A WebhookReply returned from webhookHandler will be written in the response,
+// or be sent with a separate API request when it includes files or webhookHandler does not return in timeoutSeconds.
+//
+// If webhookHandler is nil, the returned handler will respond to all requests with 500.
+// Panics in webhookHandler are recovered and logged, as it runs in a separate goroutine.
+func (b *Bot) WebhookHandlerWithReply(timeoutSeconds int, webhookHandler func(b *Bot, webhook Update, err error) *WebhookReply) http.Handler {
+	if webhookHandler == nil {
+		return b.missingWebhookHandler()
+	}
+	if timeoutSeconds <= 0 {
+		timeoutSeconds = defaultWebhookReplyTimeoutSeconds
+	}
+	timeout := time.Duration(timeoutSeconds) * time.Second
+
+	return http.HandlerFunc(func(writer http.ResponseWriter, req *http.Request) {
+		b.serveWebhook(writer, req, func(webhook Update, err error) *WebhookReply {
+			if err != nil {
+				webhookHandler(b, webhook, err)
+
+				return nil
+			}
+
+			replied := make(chan *WebhookReply, 1)
+			go func() {
+				var reply *WebhookReply
+				defer func() {
+					if r := recover(); r != nil {
+						b.error("panic in webhook handler: %v", r)
+					}
+					replied <- reply
+				}()
+
+				reply = webhookHandler(b, webhook, nil)
+			}()
+
+			select {
+			case reply := <-replied:
+				return reply
+			case <-time.After(timeout):
+				b.error("webhook handler did not return in %d second(s), reply will be sent separately", timeoutSeconds)
+
+				go func() {
+					if reply := <-replied; reply != nil {
+						b.sendWebhookReply(reply)
+					}
+				}()
+
+				return nil
+			}
+		})
+	})
+}
+
+// Write given reply in the response of a webhook request.
+func (b *Bot) writeWebhookReply(writer http.ResponseWriter, reply *WebhookReply) {
+	if reply == nil {
+		writer.WriteHeader(http.StatusOK)
+		return
+	}
+
+	// files cannot be uploaded in the response
+	if checkIfFileParamExists(reply.Params) {
+		b.verbose("webhook reply includes file(s), sending it separately: %s", reply.Method)
+
+		writer.WriteHeader(http.StatusOK)
+
+		go b.sendWebhookReply(reply)
+		return
+	}
+
+	body := map[string]interface{}{
+		"method": reply.Method,
+	}
+	for key, value := range reply.Params {
+		if _, ok := value.(InputFile); ok {
+			if str, ok := b.paramToString(value); ok {
+				body[key] = str
+			}
+		} else {
+			body[key] = value
+		}
+	}
+
+	bytes, err := json.Marshal(body)
+	if err != nil {
+		b.error("failed to encode webhook reply, sending it separately: %s", err)
+
+		writer.WriteHeader(http.StatusOK)
+
+		go b.sendWebhookReply(reply)
+		return
+	}
+
+	b.verbose("replying to webhook with: %s", string(bytes))
+
+	writer.Header().Set("Content-Type", "application/json")
+	writer.WriteHeader(http.StatusOK)
+	if _, err = writer.Write(bytes); err != nil {
+		b.error("failed to write webhook reply: %s", err)
+	}
+}
+
+// Send given reply with a separate API request.
+func (b *Bot) sendWebhookReply(reply *WebhookReply) {
+	if res := b.requestResponseBase(reply.Method, reply.Params); !res.Ok {
+		b.error("failed to send webhook reply (%s): %s", reply.Method, descriptionOf(res))
+	}
+}
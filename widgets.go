@@ -0,0 +1,572 @@
+package telegrambot
+
+// Interactive inline keyboard widgets (list picker, calendar, confirmation, and checklist)
+//
+// Widgets keep their states in callback data signed by a CallbackCodec, and edit their messages in place.
+
+import (
+	"fmt"
+	"strconv"
+	"sync"
+	"time"
+)
+
+const (
+	widgetKindPrefix          = "w:"
+	defaultListPickerPageSize = 8
+	defaultCalendarMinuteStep = 15
+	maxChecklistItems         = 64 // number of bits in the state of checklists
+)
+
+// actions of widget buttons
+const (
+	widgetActionNoop   uint8 = iota // buttons which do nothing (eg. labels)
+	widgetActionPage                // list picker: move to page
+	widgetActionSelect              // list picker: select an item
+	widgetActionMonth               // calendar: show month
+	widgetActionDate                // calendar: pick date
+	widgetActionHour                // calendar: pick hour
+	widgetActionMinute              // calendar: pick minute
+	widgetActionYes                 // confirm: yes
+	widgetActionNo                  // confirm: no
+	widgetActionToggle              // checklist: toggle an item
+	widgetActionDone                // checklist: done
+)
+
+// payload of widget buttons (encoded by CallbackCodec)
+type widgetPayload struct {
+	Action uint8
+	Num    int64  // page, index, or unix time
+	State  uint64 // checked items of checklists
+	Arg    string // value of items, or payload of confirmations
+}
+
+// ListItem is an item of list widgets
+type ListItem struct {
+	Text  string // label of the button
+	Value string // value in callback data (should be short)
+}
+
+// WidgetManager routes callback queries of widgets
+type WidgetManager struct {
+	router *CallbackRouter
+	codec  *CallbackCodec
+
+	sync.RWMutex
+	handlers map[string]func(b *Bot, update Update, cb *Callback, payload widgetPayload)
+}
+
+// NewWidgetManager generates a new WidgetManager which registers widgets to given router.
+//
+// Callback data of widgets are signed with given codec, so forged ones are rejected.
+func NewWidgetManager(router *CallbackRouter, codec *CallbackCodec) *WidgetManager {
+	return &WidgetManager{
+		router:   router,
+		codec:    codec,
+		handlers: map[string]func(b *Bot, update Update, cb *Callback, payload widgetPayload){},
+	}
+}
+
+// Register a widget's handler with its name.
+func (m *WidgetManager) register(name string, handler func(b *Bot, update Update, cb *Callback, payload widgetPayload)) {
+	m.Lock()
+	defer m.Unlock()
+
+	if _, exists := m.handlers[name]; !exists {
+		m.router.Kind(m.codec, widgetKindPrefix+name, func(b *Bot, update Update, cb *Callback) {
+			m.handle(b, update, cb, name)
+		})
+	}
+	m.handlers[name] = handler
+}
+
+// Handle a callback query of a widget.
+func (m *WidgetManager) handle(b *Bot, update Update, cb *Callback, name string) {
+	var payload widgetPayload
+	if _, err := cb.DecodeData(m.codec, &payload); err != nil {
+		b.verbose("rejecting callback data of widget '%s': %s", name, err)
+		return
+	}
+
+	m.RLock()
+	handler := m.handlers[name]
+	m.RUnlock()
+
+	if payload.Action == widgetActionNoop {
+		return
+	}
+
+	handler(b, update, cb, payload)
+}
+
+// Generate a button for a widget. (errors of callback data are accumulated)
+func (m *WidgetManager) button(text, name string, payload widgetPayload, err *error) InlineKeyboardButton {
+	button, e := m.codec.InlineKeyboardButton(text, widgetKindPrefix+name, payload)
+	if e != nil {
+		if *err == nil {
+			*err = fmt.Errorf("failed to encode callback data of widget '%s': %w", name, e)
+		}
+		return InlineKeyboardButton{Text: text}
+	}
+	return button
+}
+
+// Remove the keyboard of a widget's message.
+func removeWidgetKeyboard(b *Bot, cb *Callback) {
+	if edited := cb.EditReplyMarkup(InlineKeyboardMarkup{InlineKeyboard: [][]InlineKeyboardButton{}}); !edited.Ok {
+		b.error("failed to remove keyboard of widget: %s", descriptionOf(edited.APIResponseBase))
+	}
+}
+
+// Replace the keyboard of a widget's message.
+func replaceWidgetKeyboard(b *Bot, cb *Callback, markup InlineKeyboardMarkup, err error) {
+	if err != nil {
+		b.error("failed to render widget: %s", err)
+		return
+	}
+	if edited := cb.EditReplyMarkup(markup); !edited.Ok {
+		b.error("failed to update keyboard of widget: %s", descriptionOf(edited.APIResponseBase))
+	}
+}
+
+////////////////////////////////
+// List picker
+//
+
+// ListPickerConfig is a struct of configurations for ListPicker
+type ListPickerConfig struct {
+	Items    func() []ListItem // called on every rendering
+	PageSize int               // default: 8
+	Columns  int               // default: 1
+
+	PrevText string // default: "◀"
+	NextText string // default: "▶"
+
+	// called with the picked item (after the keyboard is removed)
+	OnPick func(b *Bot, update Update, cb *Callback, item ListItem)
+}
+
+// ListPicker is a widget for picking an item from a paginated list
+type ListPicker struct {
+	manager *WidgetManager
+	name    string
+	config  ListPickerConfig
+}
+
+// ListPicker generates a new ListPicker with given name.
+func (m *WidgetManager) ListPicker(name string, config ListPickerConfig) *ListPicker {
+	if config.PageSize <= 0 {
+		config.PageSize = defaultListPickerPageSize
+	}
+	if config.Columns <= 0 {
+		config.Columns = 1
+	}
+	if config.PrevText == "" {
+		config.PrevText = "◀"
+	}
+	if config.NextText == "" {
+		config.NextText = "▶"
+	}
+
+	p := &ListPicker{manager: m, name: name, config: config}
+	m.register(name, p.handle)
+
+	return p
+}
+
+// Markup renders the keyboard of given page. (from 0)
+func (p *ListPicker) Markup(page int) (markup InlineKeyboardMarkup, err error) {
+	items := p.config.Items()
+
+	pages := (len(items) + p.config.PageSize - 1) / p.config.PageSize
+	if page >= pages {
+		page = pages - 1
+	}
+	if page < 0 {
+		page = 0
+	}
+
+	start := page * p.config.PageSize
+	end := start + p.config.PageSize
+	if end > len(items) {
+		end = len(items)
+	}
+
+	var row []InlineKeyboardButton
+	for _, item := range items[start:end] {
+		row = append(row, p.manager.button(item.Text, p.name, widgetPayload{Action: widgetActionSelect, Arg: item.Value}, &err))
+		if len(row) >= p.config.Columns {
+			markup.InlineKeyboard = append(markup.InlineKeyboard, row)
+			row = nil
+		}
+	}
+	if len(row) > 0 {
+		markup.InlineKeyboard = append(markup.InlineKeyboard, row)
+	}
+
+	// navigation
+	if pages > 1 {
+		nav := []InlineKeyboardButton{}
+		if page > 0 {
+			nav = append(nav, p.manager.button(p.config.PrevText, p.name, widgetPayload{Action: widgetActionPage, Num: int64(page - 1)}, &err))
+		}
+		nav = append(nav, p.manager.button(fmt.Sprintf("%d/%d", page+1, pages), p.name, widgetPayload{}, &err))
+		if page < pages-1 {
+			nav = append(nav, p.manager.button(p.config.NextText, p.name, widgetPayload{Action: widgetActionPage, Num: int64(page + 1)}, &err))
+		}
+		markup.InlineKeyboard = append(markup.InlineKeyboard, nav)
+	}
+
+	return markup, err
+}
+
+// Handle callback queries of the list picker.
+func (p *ListPicker) handle(b *Bot, update Update, cb *Callback, payload widgetPayload) {
+	switch payload.Action {
+	case widgetActionPage:
+		markup, err := p.Markup(int(payload.Num))
+		replaceWidgetKeyboard(b, cb, markup, err)
+	case widgetActionSelect:
+		for _, item := range p.config.Items() {
+			if item.Value == payload.Arg {
+				removeWidgetKeyboard(b, cb)
+
+				if p.config.OnPick != nil {
+					p.config.OnPick(b, update, cb, item)
+				}
+				return
+			}
+		}
+		cb.AnswerWithText("The item is not available anymore.", false)
+	}
+}
+
+////////////////////////////////
+// Calendar
+//
+
+// CalendarConfig is a struct of configurations for Calendar
+type CalendarConfig struct {
+	WithTime   bool           // pick time (hour and minute) after date
+	MinuteStep int            // default: 15
+	Location   *time.Location // default: UTC
+
+	// called with the picked date (and time) (after the keyboard is removed)
+	OnPick func(b *Bot, update Update, cb *Callback, picked time.Time)
+}
+
+// Calendar is a widget for picking a date (and time) from a month calendar
+type Calendar struct {
+	manager *WidgetManager
+	name    string
+	config  CalendarConfig
+}
+
+// Calendar generates a new Calendar with given name.
+func (m *WidgetManager) Calendar(name string, config CalendarConfig) *Calendar {
+	if config.MinuteStep <= 0 || config.MinuteStep > 60 {
+		config.MinuteStep = defaultCalendarMinuteStep
+	}
+	if config.Location == nil {
+		config.Location = time.UTC
+	}
+
+	c := &Calendar{manager: m, name: name, config: config}
+	m.register(name, c.handle)
+
+	return c
+}
+
+// Generate a button of the calendar with given action and time.
+func (c *Calendar) button(text string, action uint8, t time.Time, err *error) InlineKeyboardButton {
+	return c.manager.button(text, c.name, widgetPayload{Action: action, Num: t.Unix()}, err)
+}
+
+// Markup renders the keyboard of the month which contains given time.
+func (c *Calendar) Markup(month time.Time) (markup InlineKeyboardMarkup, err error) {
+	month = month.In(c.config.Location)
+	first := time.Date(month.Year(), month.Month(), 1, 0, 0, 0, 0, c.config.Location)
+	noop := c.manager.button(" ", c.name, widgetPayload{}, &err)
+
+	// header
+	label := noop
+	label.Text = first.Format("January 2006")
+	markup.InlineKeyboard = append(markup.InlineKeyboard, []InlineKeyboardButton{
+		c.button("◀", widgetActionMonth, first.AddDate(0, -1, 0), &err),
+		label,
+		c.button("▶", widgetActionMonth, first.AddDate(0, 1, 0), &err),
+	})
+
+	// weekdays (from monday)
+	weekdays := []InlineKeyboardButton{}
+	for _, weekday := range []string{"Mo", "Tu", "We", "Th", "Fr", "Sa", "Su"} {
+		label := noop
+		label.Text = weekday
+		weekdays = append(weekdays, label)
+	}
+	markup.InlineKeyboard = append(markup.InlineKeyboard, weekdays)
+
+	// days
+	row := []InlineKeyboardButton{}
+	for i := 0; i < (int(first.Weekday())+6)%7; i++ {
+		row = append(row, noop)
+	}
+	for day := first; day.Month() == first.Month(); day = day.AddDate(0, 0, 1) {
+		row = append(row, c.button(strconv.Itoa(day.Day()), widgetActionDate, day, &err))
+		if len(row) == 7 {
+			markup.InlineKeyboard = append(markup.InlineKeyboard, row)
+			row = []InlineKeyboardButton{}
+		}
+	}
+	if len(row) > 0 {
+		for len(row) < 7 {
+			row = append(row, noop)
+		}
+		markup.InlineKeyboard = append(markup.InlineKeyboard, row)
+	}
+
+	return markup, err
+}
+
+// Render the keyboard for picking an hour of given date.
+func (c *Calendar) hoursMarkup(date time.Time) (markup InlineKeyboardMarkup, err error) {
+	label := c.manager.button(date.Format("2006-01-02"), c.name, widgetPayload{}, &err)
+	markup.InlineKeyboard = append(markup.InlineKeyboard, []InlineKeyboardButton{
+		c.button("◀", widgetActionMonth, date, &err),
+		label,
+	})
+
+	for hour := 0; hour < 24; hour += 6 {
+		row := []InlineKeyboardButton{}
+		for h := hour; h < hour+6; h++ {
+			t := time.Date(date.Year(), date.Month(), date.Day(), h, 0, 0, 0, c.config.Location)
+			row = append(row, c.button(fmt.Sprintf("%02d", h), widgetActionHour, t, &err))
+		}
+		markup.InlineKeyboard = append(markup.InlineKeyboard, row)
+	}
+
+	return markup, err
+}
+
+// Render the keyboard for picking a minute of given hour.
+func (c *Calendar) minutesMarkup(hour time.Time) (markup InlineKeyboardMarkup, err error) {
+	date := time.Date(hour.Year(), hour.Month(), hour.Day(), 0, 0, 0, 0, c.config.Location)
+	label := c.manager.button(hour.Format("2006-01-02 15:00"), c.name, widgetPayload{}, &err)
+	markup.InlineKeyboard = append(markup.InlineKeyboard, []InlineKeyboardButton{
+		c.button("◀", widgetActionDate, date, &err),
+		label,
+	})
+
+	row := []InlineKeyboardButton{}
+	for minute := 0; minute < 60; minute += c.config.MinuteStep {
+		t := hour.Add(time.Duration(minute) * time.Minute)
+		row = append(row, c.button(t.Format("15:04"), widgetActionMinute, t, &err))
+		if len(row) == 4 {
+			markup.InlineKeyboard = append(markup.InlineKeyboard, row)
+			row = []InlineKeyboardButton{}
+		}
+	}
+	if len(row) > 0 {
+		markup.InlineKeyboard = append(markup.InlineKeyboard, row)
+	}
+
+	return markup, err
+}
+
+// Handle callback queries of the calendar.
+func (c *Calendar) handle(b *Bot, update Update, cb *Callback, payload widgetPayload) {
+	t := time.Unix(payload.Num, 0).In(c.config.Location)
+
+	switch payload.Action {
+	case widgetActionMonth:
+		markup, err := c.Markup(t)
+		replaceWidgetKeyboard(b, cb, markup, err)
+	case widgetActionDate:
+		if c.config.WithTime {
+			markup, err := c.hoursMarkup(t)
+			replaceWidgetKeyboard(b, cb, markup, err)
+		} else {
+			c.pick(b, update, cb, t)
+		}
+	case widgetActionHour:
+		markup, err := c.minutesMarkup(t)
+		replaceWidgetKeyboard(b, cb, markup, err)
+	case widgetActionMinute:
+		c.pick(b, update, cb, t)
+	}
+}
+
+// Finish picking.
+func (c *Calendar) pick(b *Bot, update Update, cb *Callback, picked time.Time) {
+	removeWidgetKeyboard(b, cb)
+
+	if c.config.OnPick != nil {
+		c.config.OnPick(b, update, cb, picked)
+	}
+}
+
+////////////////////////////////
+// Confirmation
+//
+
+// ConfirmConfig is a struct of configurations for Confirm
+type ConfirmConfig struct {
+	YesText string // default: "Yes"
+	NoText  string // default: "No"
+
+	// called with the answer and the payload of the dialog (after the keyboard is removed)
+	OnAnswer func(b *Bot, update Update, cb *Callback, confirmed bool, payload string)
+}
+
+// Confirm is a widget for yes/no confirmations
+type Confirm struct {
+	manager *WidgetManager
+	name    string
+	config  ConfirmConfig
+}
+
+// Confirm generates a new Confirm with given name.
+func (m *WidgetManager) Confirm(name string, config ConfirmConfig) *Confirm {
+	if config.YesText == "" {
+		config.YesText = "Yes"
+	}
+	if config.NoText == "" {
+		config.NoText = "No"
+	}
+
+	c := &Confirm{manager: m, name: name, config: config}
+	m.register(name, c.handle)
+
+	return c
+}
+
+// Markup renders the keyboard with given payload. (eg. id of the thing to be confirmed)
+func (c *Confirm) Markup(payload string) (markup InlineKeyboardMarkup, err error) {
+	markup.InlineKeyboard = [][]InlineKeyboardButton{
+		{
+			c.manager.button(c.config.YesText, c.name, widgetPayload{Action: widgetActionYes, Arg: payload}, &err),
+			c.manager.button(c.config.NoText, c.name, widgetPayload{Action: widgetActionNo, Arg: payload}, &err),
+		},
+	}
+	return markup, err
+}
+
+// Handle callback queries of the confirmation.
+func (c *Confirm) handle(b *Bot, update Update, cb *Callback, payload widgetPayload) {
+	if payload.Action != widgetActionYes && payload.Action != widgetActionNo {
+		return
+	}
+
+	removeWidgetKeyboard(b, cb)
+
+	if c.config.OnAnswer != nil {
+		c.config.OnAnswer(b, update, cb, payload.Action == widgetActionYes, payload.Arg)
+	}
+}
+
+////////////////////////////////
+// Checklist
+//
+
+// ChecklistConfig is a struct of configurations for Checklist
+type ChecklistConfig struct {
+	Items []ListItem // at most 64 items
+
+	CheckedPrefix   string // default: "✅ "
+	UncheckedPrefix string // default: "⬜ "
+	DoneText        string // default: "Done"
+
+	// called with the checked items (after the keyboard is removed)
+	OnDone func(b *Bot, update Update, cb *Callback, checked []ListItem)
+}
+
+// Checklist is a widget for selecting multiple items
+type Checklist struct {
+	manager *WidgetManager
+	name    string
+	config  ChecklistConfig
+}
+
+// Checklist generates a new Checklist with given name.
+//
+// It returns an error if there are more than 64 items.
+func (m *WidgetManager) Checklist(name string, config ChecklistConfig) (*Checklist, error) {
+	if len(config.Items) > maxChecklistItems {
+		return nil, fmt.Errorf("checklist '%s' has more than %d items: %d", name, maxChecklistItems, len(config.Items))
+	}
+	if config.CheckedPrefix == "" {
+		config.CheckedPrefix = "✅ "
+	}
+	if config.UncheckedPrefix == "" {
+		config.UncheckedPrefix = "⬜ "
+	}
+	if config.DoneText == "" {
+		config.DoneText = "Done"
+	}
+
+	c := &Checklist{manager: m, name: name, config: config}
+	m.register(name, c.handle)
+
+	return c, nil
+}
+
+// Markup renders the keyboard with given items checked. (by their values)
+func (c *Checklist) Markup(checkedValues ...string) (InlineKeyboardMarkup, error) {
+	var checked uint64
+	for i, item := range c.config.Items {
+		for _, value := range checkedValues {
+			if item.Value == value {
+				checked |= 1 << uint(i)
+			}
+		}
+	}
+
+	return c.markup(checked)
+}
+
+// Render the keyboard with a bit set of checked items.
+func (c *Checklist) markup(checked uint64) (markup InlineKeyboardMarkup, err error) {
+	for i, item := range c.config.Items {
+		prefix := c.config.UncheckedPrefix
+		if checked&(1<<uint(i)) != 0 {
+			prefix = c.config.CheckedPrefix
+		}
+		markup.InlineKeyboard = append(markup.InlineKeyboard, []InlineKeyboardButton{
+			c.manager.button(prefix+item.Text, c.name, widgetPayload{Action: widgetActionToggle, Num: int64(i), State: checked}, &err),
+		})
+	}
+	markup.InlineKeyboard = append(markup.InlineKeyboard, []InlineKeyboardButton{
+		c.manager.button(c.config.DoneText, c.name, widgetPayload{Action: widgetActionDone, State: checked}, &err),
+	})
+
+	return markup, err
+}
+
+// Handle callback queries of the checklist.
+func (c *Checklist) handle(b *Bot, update Update, cb *Callback, payload widgetPayload) {
+	checked := payload.State
+
+	switch payload.Action {
+	case widgetActionToggle:
+		if payload.Num < 0 || payload.Num >= int64(len(c.config.Items)) {
+			return
+		}
+		checked ^= 1 << uint(payload.Num)
+
+		markup, err := c.markup(checked)
+		replaceWidgetKeyboard(b, cb, markup, err)
+	case widgetActionDone:
+		items := []ListItem{}
+		for i, item := range c.config.Items {
+			if checked&(1<<uint(i)) != 0 {
+				items = append(items, item)
+			}
+		}
+
+		removeWidgetKeyboard(b, cb)
+
+		if c.config.OnDone != nil {
+			c.config.OnDone(b, update, cb, items)
+		}
+	}
+}